@@ -14,16 +14,21 @@ type Currency struct {
 }
 
 type Country struct {
-	Name       string     `json:"name"`
-	Capital    string     `json:"capital"`
-	Region     string     `json:"region"`
-	Population int64      `json:"population"`
-	Currencies []Currency `json:"currencies"`
-	FlagURL    string     `json:"flag" gorm:"size:512"`
+	Name         string     `json:"name"`
+	Alpha2Code   string     `json:"alpha2Code"`
+	Alpha3Code   string     `json:"alpha3Code"`
+	AltSpellings []string   `json:"altSpellings"`
+	Capital      string     `json:"capital"`
+	Region       string     `json:"region"`
+	Population   int64      `json:"population"`
+	Currencies   []Currency `json:"currencies"`
+	FlagURL      string     `json:"flag" gorm:"size:512"`
 }
 
 type ExchangeRates struct {
-	Rates map[string]float64 `json:"rates"`
+	BaseCode           string             `json:"base_code"`
+	TimeLastUpdateUnix int64              `json:"time_last_update_unix"`
+	Rates              map[string]float64 `json:"rates"`
 }
 
 // Fetches a list countries from the RestCountries REST API
@@ -31,7 +36,7 @@ func GetCountries() (*[]Country, error) {
 	var countries []Country
 
 	client := http.Client{}
-	url := "https://restcountries.com/v2/all?fields=name,capital,region,population,flag,currencies"
+	url := "https://restcountries.com/v2/all?fields=name,alpha2Code,alpha3Code,altSpellings,capital,region,population,flag,currencies"
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		log.Println("Failed to make GET request because ", err.Error())
@@ -60,13 +65,14 @@ func GetCountries() (*[]Country, error) {
 	return &countries, nil
 }
 
-func GetExchangeRates() (*ExchangeRates, error) {
+// Fetches the latest exchange rates quoted against the base currency
+func GetExchangeRates(baseCurrency string) (*ExchangeRates, error) {
 	var rates ExchangeRates
 
 	// Make HTTP request
 	client := http.Client{}
 
-	url := "https://open.er-api.com/v6/latest/USD"
+	url := fmt.Sprintf("https://open.er-api.com/v6/latest/%s", baseCurrency)
 
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
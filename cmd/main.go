@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,11 +10,35 @@ import (
 	"syscall"
 	"task_2/config"
 	"task_2/initializers"
+	"task_2/repository"
 	"task_2/routes"
+	"task_2/services"
+	"task_2/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// overrideExpiryInterval is how often expired overrides are rolled back
+const overrideExpiryInterval = 30 * time.Second
+
+// expireOverrides writes expired overrides back to their countries every
+// interval until ctx is cancelled
+func expireOverrides(ctx context.Context, countryService services.CountryService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := countryService.ExpireOverrides(ctx); err != nil {
+				log.Println("Failed to expire overrides because", err.Error())
+			}
+		}
+	}
+}
+
 func main() {
 	// Load config
 	cfg, err := config.LoadConfig()
@@ -21,6 +46,14 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Load the fonts and themes used in generated images
+	if err := utils.LoadFonts(cfg.FontFiles, cfg.BoldFontFiles); err != nil {
+		log.Fatalf("Failed to load fonts: %v", err)
+	}
+	if err := utils.LoadThemes(cfg.ImageThemesFile); err != nil {
+		log.Fatalf("Failed to load image themes: %v", err)
+	}
+
 	// Obtain MySQL connection
 	db, err := initializers.ConnectToDB(cfg.DBString)
 	if err != nil {
@@ -32,11 +65,22 @@ func main() {
 		log.Fatalf("Failed to perform database migrations: %v", err)
 	}
 
+	// Record writes to country data in the audit log
+	if err := repository.RegisterAuditCallbacks(db); err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
 	log.Println("Database connected and migrations applied")
 	
 	// HTTP server start up stuff...
 	router := gin.Default()
-	routes.SetupRoutes(router, db)
+	countryService := routes.SetupRoutes(router, db, cfg)
+
+	// Expired overrides are written back to their countries in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go expireOverrides(ctx, countryService, overrideExpiryInterval)
+
 	err = http.ListenAndServe(fmt.Sprintf(":%s", cfg.Port), router)
 	if err != nil {
 		log.Println("Failed to start HTTP server because ", err.Error())
@@ -45,5 +89,6 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
+	cancel()
 	log.Println("Shutting down")
 }
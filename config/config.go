@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -10,6 +13,14 @@ import (
 type Config struct {
 	Port string 
 	DBString string 
+	BaseCurrency string
+	CacheSize int
+	CacheTTL time.Duration
+	DeletionRetention time.Duration
+	BulkDeleteSecret string
+	FontFiles []string
+	BoldFontFiles []string
+	ImageThemesFile string
 }
 
 // Loads the configuration from an .env variable 
@@ -23,15 +34,63 @@ func LoadConfig() (*Config, error) {
 	// Get the env values for port and MySQL db host
 	port := getVal("PORT", ":4000")
 	dbString := getVal("DB_STRING", "")
+	// Currency the exchange rates and GDP estimates are quoted in
+	baseCurrency := strings.ToUpper(getVal("BASE_CURRENCY", "USD"))
 
 	config.Port = port
 	config.DBString = dbString
+	config.BaseCurrency = baseCurrency
+
+	// Query cache: number of cached results and how long each is kept.
+	// A size of 0 disables the cache.
+	cacheSize, err := strconv.Atoi(getVal("CACHE_SIZE", "1000"))
+	if err != nil || cacheSize < 0 {
+		log.Fatal("CACHE_SIZE must be a non-negative integer")
+	}
+	cacheTTL, err := time.ParseDuration(getVal("CACHE_TTL", "5m"))
+	if err != nil || cacheTTL <= 0 {
+		log.Fatal("CACHE_TTL must be a positive duration such as 30s or 5m")
+	}
+	config.CacheSize = cacheSize
+	config.CacheTTL = cacheTTL
+
+	// How long deleted countries can be restored
+	deletionRetention, err := time.ParseDuration(getVal("DELETION_RETENTION", "72h"))
+	if err != nil || deletionRetention <= 0 {
+		log.Fatal("DELETION_RETENTION must be a positive duration such as 24h")
+	}
+	config.DeletionRetention = deletionRetention
+	// Signs bulk delete tokens. Tokens signed with an empty key could be
+	// forged, so bulk delete is disabled without it.
+	config.BulkDeleteSecret = getVal("BULK_DELETE_SECRET", "")
+	if config.BulkDeleteSecret == "" {
+		log.Println("BULK_DELETE_SECRET is not set, bulk delete is disabled")
+	}
+
+	// Fonts for generated images, in order of preference. The embedded Go
+	// fonts cover whatever these don't.
+	config.FontFiles = splitPaths(getVal("FONT_FILES", ""))
+	config.BoldFontFiles = splitPaths(getVal("FONT_BOLD_FILES", ""))
+	// Extra or replacement themes for the summary image
+	config.ImageThemesFile = strings.TrimSpace(getVal("IMAGE_THEMES_FILE", ""))
 
 	return &config, err
 }
 
+func splitPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// getVal reads an env value. Empty values count as unset, so the blank
+// entries of .env.example fall back to the defaults.
 func getVal(key, defaultValue string) string{
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := os.LookupEnv(key); exists && strings.TrimSpace(value) != "" {
 		return value
 	}
 	return defaultValue
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type RefreshCountriesResponse struct {
 	Status string `json:"status"`
 }
@@ -9,9 +11,25 @@ type GetCountryStatsResponse struct {
 	LastRefreshedAt string `json:"last_refreshed_at"`
 }
 
+// DatasetState identifies the current version of the data for conditional GETs
+type DatasetState struct {
+	Version      uint64
+	LastModified time.Time
+}
+
+// CountryVersion identifies one revision of a country, for its ETag
+type CountryVersion struct {
+	ID        uint
+	Version   uint64
+	UpdatedAt time.Time
+}
+
 type GetCountryByNameResponse struct {
 	ID              uint     `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name            string   `gorm:"size:255;not null" json:"name"`
+	Alpha2Code      string   `gorm:"size:2" json:"alpha2_code"`
+	Alpha3Code      string   `gorm:"size:3" json:"alpha3_code"`
+	Slug            string   `gorm:"size:255" json:"slug"`
 	Capital         string   `gorm:"size:255" json:"capital"`
 	Region          string   `gorm:"size:255" json:"region"`
 	Population      int64    `gorm:"not null" json:"population"`
@@ -20,11 +38,15 @@ type GetCountryByNameResponse struct {
 	EstimatedGDP    *float64 `json:"estimated_gdp"`
 	FlagURL         string   `gorm:"size:512" json:"flag_url"`
 	LastRefreshedAt string   `gorm:"autoUpdateTime" json:"last_refreshed_at"`
+	Version         uint64   `json:"version"`
 }
 
 type FilterCountriesResponse struct {
 	ID              uint     `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name            string   `gorm:"size:255;not null" json:"name"`
+	Alpha2Code      string   `gorm:"size:2" json:"alpha2_code"`
+	Alpha3Code      string   `gorm:"size:3" json:"alpha3_code"`
+	Slug            string   `gorm:"size:255" json:"slug"`
 	Capital         string   `gorm:"size:255" json:"capital"`
 	Region          string   `gorm:"size:255" json:"region"`
 	Population      int64    `gorm:"not null" json:"population"`
@@ -33,4 +55,318 @@ type FilterCountriesResponse struct {
 	EstimatedGDP    *float64 `json:"estimated_gdp"`
 	FlagURL         string   `gorm:"size:512" json:"flag_url"`
 	LastRefreshedAt string   `gorm:"autoUpdateTime" json:"last_refreshed_at"`
+	Version         uint64   `json:"version"`
+}
+
+// ShapeOptions carries the fields, exclude, embed and currency_base query
+// parameters used to shape country responses.
+type ShapeOptions struct {
+	Fields       []string
+	Exclude      []string
+	Embed        []string
+	CurrencyBase string
+}
+
+type CurrencyEmbed struct {
+	Code         string   `json:"code"`
+	Name         string   `json:"name"`
+	Symbol       string   `json:"symbol"`
+	ExchangeRate *float64 `json:"exchange_rate"`
+}
+
+type CountrySearchResult struct {
+	FilterCountriesResponse
+	Score        float64 `json:"score"`
+	MatchType    string  `json:"match_type"`
+	MatchedAlias string  `json:"matched_alias,omitempty"`
+}
+
+type AddAliasRequest struct {
+	Alias string `json:"alias" binding:"required"`
+}
+
+type CountryAliasResponse struct {
+	Alias     string `json:"alias"`
+	Source    string `json:"source"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AggregateStats are the summary figures shared by region and group stats.
+type AggregateStats struct {
+	CountryCount        int64    `json:"country_count"`
+	TotalPopulation     int64    `json:"total_population"`
+	MedianPopulation    *float64 `json:"median_population"`
+	TotalEstimatedGDP   *float64 `json:"total_estimated_gdp"`
+	MeanEstimatedGDP    *float64 `json:"mean_estimated_gdp"`
+	MedianEstimatedGDP  *float64 `json:"median_estimated_gdp"`
+	GDPPerCapita        *float64 `json:"gdp_per_capita"`
+	MissingExchangeRate int64    `json:"missing_exchange_rate"`
+	MissingCurrency     int64    `json:"missing_currency"`
+}
+
+type RegionStatsResponse struct {
+	Region string `json:"region"`
+	AggregateStats
+}
+
+type CurrencyResponse struct {
+	Code         string   `json:"code"`
+	Name         string   `json:"name"`
+	Symbol       string   `json:"symbol"`
+	ExchangeRate *float64 `json:"exchange_rate"`
+	CountryCount int64    `json:"country_count"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+type CurrencyDetailResponse struct {
+	CurrencyResponse
+	Countries []FilterCountriesResponse `json:"countries"`
+}
+
+type RateHistoryEntry struct {
+	Rate      float64 `json:"rate"`
+	BaseCode  string  `json:"base_code"`
+	FetchedAt string  `json:"fetched_at"`
+}
+
+type ConversionRate struct {
+	Code string  `json:"code"`
+	Rate float64 `json:"rate"`
+	AsOf string  `json:"as_of,omitempty"`
+}
+
+type ConvertResponse struct {
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	Amount    float64          `json:"amount"`
+	Result    float64          `json:"result"`
+	Rate      float64          `json:"rate"`
+	Base      string           `json:"base"`
+	RatesUsed []ConversionRate `json:"rates_used"`
+	AsOf      string           `json:"as_of,omitempty"`
+}
+
+type MetricPosition struct {
+	Global *int64 `json:"global"`
+	Region *int64 `json:"region"`
+}
+
+type ComparedCountry struct {
+	FilterCountriesResponse
+	GDPPerCapita *float64                  `json:"gdp_per_capita"`
+	Ranks        map[string]MetricPosition `json:"ranks"`
+}
+
+type MetricDifference struct {
+	Absolute *float64 `json:"absolute"`
+	Relative *float64 `json:"relative"`
+}
+
+type CountryDifference struct {
+	Country  string                      `json:"country"`
+	Baseline string                      `json:"baseline"`
+	Metrics  map[string]MetricDifference `json:"metrics"`
+}
+
+type MissingCountry struct {
+	Name        string   `json:"name"`
+	Error       string   `json:"error"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+type CompareResponse struct {
+	Countries   []ComparedCountry   `json:"countries"`
+	Differences []CountryDifference `json:"differences"`
+	Missing     []MissingCountry    `json:"missing"`
+}
+
+type RankingEntry struct {
+	Rank       int64   `json:"rank"`
+	DenseRank  int64   `json:"dense_rank"`
+	Percentile float64 `json:"percentile"`
+	ID         uint    `json:"id"`
+	Name       string  `json:"name"`
+	Region     string  `json:"region"`
+	Value      float64 `json:"value"`
+	Total      int64   `json:"total"`
+}
+
+type ScopedRank struct {
+	Rank       int64   `json:"rank"`
+	DenseRank  int64   `json:"dense_rank"`
+	Percentile float64 `json:"percentile"`
+	Total      int64   `json:"total"`
+}
+
+type CountryMetricRanking struct {
+	Value  float64     `json:"value"`
+	Global *ScopedRank `json:"global"`
+	Region *ScopedRank `json:"region"`
+}
+
+type CountryRankingsResponse struct {
+	ID       uint                             `json:"id"`
+	Name     string                           `json:"name"`
+	Region   string                           `json:"region"`
+	Rankings map[string]*CountryMetricRanking `json:"rankings"`
+}
+
+type BatchLookupRequest struct {
+	Names []string `json:"names"`
+	Codes []string `json:"codes"`
+}
+
+type BatchMiss struct {
+	Identifier string `json:"identifier"`
+	Reason     string `json:"reason"`
+}
+
+type BatchLookupResponse struct {
+	Countries []ShapedCountry `json:"countries"`
+	NotFound  []BatchMiss     `json:"not_found"`
+}
+
+// CountryRequest is the body of POST /countries and PUT /countries/:name.
+// PATCH takes a JSON Merge Patch of the same document.
+type CountryRequest struct {
+	Name         string  `json:"name"`
+	Alpha2Code   string  `json:"alpha2_code"`
+	Alpha3Code   string  `json:"alpha3_code"`
+	Capital      string  `json:"capital"`
+	Region       string  `json:"region"`
+	Population   *int64  `json:"population"`
+	CurrencyCode *string `json:"currency_code"`
+	FlagURL      string  `json:"flag_url"`
+}
+
+// OverrideRequest is the body of PUT /countries/:name/overrides/:field
+type OverrideRequest struct {
+	Value     interface{} `json:"value"`
+	Author    string      `json:"author" binding:"required"`
+	Reason    string      `json:"reason"`
+	ExpiresAt *time.Time  `json:"expires_at"`
+}
+
+type CountryOverrideResponse struct {
+	Country       string      `json:"country"`
+	Field         string      `json:"field"`
+	Value         interface{} `json:"value"`
+	UpstreamValue interface{} `json:"upstream_value"`
+	Author        string      `json:"author"`
+	Reason        string      `json:"reason"`
+	ExpiresAt     *string     `json:"expires_at"`
+	Active        bool        `json:"active"`
+	CreatedAt     string      `json:"created_at"`
+	UpdatedAt     string      `json:"updated_at"`
+}
+
+// BulkDeleteFilter selects the countries of DELETE /countries
+type BulkDeleteFilter struct {
+	Region   string
+	Currency string
+	// Stale matches countries the last refresh did not update
+	Stale bool
+}
+
+type BulkDeletePreview struct {
+	Token     string   `json:"token"`
+	ExpiresAt string   `json:"expires_at"`
+	Count     int      `json:"count"`
+	Countries []string `json:"countries"`
+}
+
+type DeletionResponse struct {
+	DeletionID       string   `json:"deletion_id"`
+	Count            int      `json:"count"`
+	Countries        []string `json:"countries,omitempty"`
+	DeletedAt        string   `json:"deleted_at"`
+	RecoverableUntil string   `json:"recoverable_until"`
+}
+
+type RestoreSkip struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type RestoreResponse struct {
+	DeletionID string        `json:"deletion_id"`
+	Restored   []string      `json:"restored"`
+	Skipped    []RestoreSkip `json:"skipped"`
+}
+
+// MetadataRequest is the body of PUT /countries/:name/metadata/:key
+type MetadataRequest struct {
+	Value interface{} `json:"value"`
+}
+
+type MetadataEntry struct {
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	Type      string      `json:"type"`
+	UpdatedAt string      `json:"updated_at"`
+}
+
+// GroupRequest is the body of POST /groups and PUT /groups/:id. PUT only
+// replaces the members when members is given.
+type GroupRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Members     []string `json:"members"`
+}
+
+// GroupMembersRequest is the body of POST /groups/:id/members
+type GroupMembersRequest struct {
+	Countries []string `json:"countries" binding:"required"`
+}
+
+type GroupResponse struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+	MemberCount int64  `json:"member_count"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type GroupDetailResponse struct {
+	GroupResponse
+	Countries []FilterCountriesResponse `json:"countries"`
+}
+
+type GroupStatsResponse struct {
+	ID    uint   `json:"id"`
+	Group string `json:"group"`
+	AggregateStats
+}
+
+// AuditChange is the old and new value of one field
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type AuditEventResponse struct {
+	ID        uint                   `json:"id"`
+	Actor     string                 `json:"actor"`
+	Action    string                 `json:"action"`
+	CountryID *uint                  `json:"country_id"`
+	Country   string                 `json:"country"`
+	RecordID  uint                   `json:"record_id"`
+	Changes   map[string]AuditChange `json:"changes"`
+	RequestID string                 `json:"request_id"`
+	CreatedAt string                 `json:"created_at"`
+}
+
+// SummaryImageOptions selects what the summary image shows and how. Zero
+// values take the defaults.
+type SummaryImageOptions struct {
+	Top    int
+	Metric string
+	Region string
+	Width  int
+	Height int
+	Theme  string
+	// Scatter adds a population vs GDP panel
+	Scatter bool
 }
@@ -0,0 +1,174 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CountryFields lists the selectable country fields in response order.
+var CountryFields = []string{
+	"id",
+	"name",
+	"alpha2_code",
+	"alpha3_code",
+	"slug",
+	"capital",
+	"region",
+	"population",
+	"currency_code",
+	"exchange_rate",
+	"estimated_gdp",
+	"flag_url",
+	"last_refreshed_at",
+	"version",
+	"overridden_fields",
+	"metadata",
+}
+
+// Computed fields are assembled from other tables rather than selected
+const (
+	// OverriddenFieldsKey lists the fields replaced by manual overrides
+	OverriddenFieldsKey = "overridden_fields"
+	// MetadataKey holds the custom key-value metadata of a country
+	MetadataKey = "metadata"
+)
+
+// IsComputedCountryField reports whether field is not a countries column
+func IsComputedCountryField(field string) bool {
+	return field == OverriddenFieldsKey || field == MetadataKey
+}
+
+// ShapedCountry is a country response trimmed to a set of fields. Keys are
+// serialized in insertion order so shaped responses keep the same layout
+// as FilterCountriesResponse.
+type ShapedCountry struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// Set adds or replaces a key, keeping its original position if present.
+func (s *ShapedCountry) Set(key string, value interface{}) {
+	if s.values == nil {
+		s.values = make(map[string]interface{})
+	}
+	if _, exists := s.values[key]; !exists {
+		s.keys = append(s.keys, key)
+	}
+	s.values[key] = value
+}
+
+// Get returns the value stored under key.
+func (s ShapedCountry) Get(key string) (interface{}, bool) {
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Keys returns the keys in serialization order.
+func (s ShapedCountry) Keys() []string {
+	return s.keys
+}
+
+func (s ShapedCountry) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range s.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(s.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (r FilterCountriesResponse) fieldValue(field string) interface{} {
+	switch field {
+	case "id":
+		return r.ID
+	case "name":
+		return r.Name
+	case "alpha2_code":
+		return r.Alpha2Code
+	case "alpha3_code":
+		return r.Alpha3Code
+	case "slug":
+		return r.Slug
+	case "capital":
+		return r.Capital
+	case "region":
+		return r.Region
+	case "population":
+		return r.Population
+	case "currency_code":
+		return r.CurrencyCode
+	case "exchange_rate":
+		return r.ExchangeRate
+	case "estimated_gdp":
+		return r.EstimatedGDP
+	case "flag_url":
+		return r.FlagURL
+	case "last_refreshed_at":
+		return r.LastRefreshedAt
+	case "version":
+		return r.Version
+	}
+	return nil
+}
+
+// Keys returns the keys of a country shaped with these options, as the
+// shaping in services produces them: the selected fields in CountryFields
+// order, then the embeds.
+func (o ShapeOptions) Keys() []string {
+	wanted := make(map[string]bool, len(CountryFields))
+	if len(o.Fields) == 0 {
+		for _, f := range CountryFields {
+			wanted[f] = true
+		}
+	}
+	for _, f := range o.Fields {
+		wanted[f] = true
+	}
+	for _, f := range o.Exclude {
+		delete(wanted, f)
+	}
+
+	var keys []string
+	for _, f := range CountryFields {
+		if wanted[f] {
+			keys = append(keys, f)
+		}
+	}
+	for _, e := range o.Embed {
+		if !wanted[e] {
+			wanted[e] = true
+			keys = append(keys, e)
+		}
+	}
+	return keys
+}
+
+// Shape projects the response onto the given fields, in CountryFields order.
+func (r FilterCountriesResponse) Shape(fields []string) ShapedCountry {
+	wanted := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		wanted[f] = true
+	}
+
+	var shaped ShapedCountry
+	for _, f := range CountryFields {
+		if wanted[f] {
+			shaped.Set(f, r.fieldValue(f))
+		}
+	}
+	return shaped
+}
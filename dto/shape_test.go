@@ -0,0 +1,27 @@
+package dto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShapeOptionsKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ShapeOptions
+		want []string
+	}{
+		{name: "all fields", opts: ShapeOptions{}, want: CountryFields},
+		{name: "fields in response order", opts: ShapeOptions{Fields: []string{"region", "name"}}, want: []string{"name", "region"}},
+		{name: "exclude", opts: ShapeOptions{Fields: []string{"id", "name", "region"}, Exclude: []string{"region"}}, want: []string{"id", "name"}},
+		{name: "embeds last", opts: ShapeOptions{Fields: []string{"name"}, Embed: []string{"currency", "currency"}}, want: []string{"name", "currency"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.Keys(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"task_2/querycache"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CacheHandler struct {
+	queryCache *querycache.QueryCache
+}
+
+// NewCacheHandler creates the handler. queryCache is nil when caching is
+// disabled.
+func NewCacheHandler(queryCache *querycache.QueryCache) *CacheHandler {
+	return &CacheHandler{
+		queryCache: queryCache,
+	}
+}
+
+func (h CacheHandler) GetStats(c *gin.Context) {
+	if h.queryCache == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	stats := h.queryCache.Stats()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":     true,
+		"hits":        stats.Hits,
+		"misses":      stats.Misses,
+		"entries":     stats.Entries,
+		"generation":  stats.Generation,
+		"ttl_seconds": stats.TTLSeconds,
+	})
+}
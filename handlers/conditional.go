@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"task_2/dto"
+	"task_2/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cacheControl lets clients and CDNs keep responses but revalidate every
+// time, which is cheap thanks to the ETag
+const cacheControl = "public, max-age=0, must-revalidate"
+
+// notModified sets ETag, Last-Modified and Cache-Control for the current
+// request from the dataset state, and answers 304 Not Modified when the
+// client's copy is still current. It returns true when the response is done.
+// The ETag covers the path, query and negotiated format, since each of them
+// changes the body.
+func (h CountryHandler) notModified(c *gin.Context) bool {
+	state, err := h.countryServices.GetDatasetState()
+	if err != nil {
+		// Caching is best effort, serve the full response instead
+		log.Println("Failed to load dataset state because", err.Error())
+		return false
+	}
+
+	etag := datasetETag(state.Version, state.LastModified, c.Request.URL.Path, c.Request.URL.RawQuery, responseFormat(c))
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	c.Header("Vary", "Accept")
+	if !state.LastModified.IsZero() {
+		c.Header("Last-Modified", state.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110)
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, etag) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" && !state.LastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !state.LastModified.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// countryNotModified is notModified for a single country. Its ETag comes
+// from the country's own version, so edits to other countries keep it valid
+// and it can be sent back in If-Match.
+func (h CountryHandler) countryNotModified(c *gin.Context, identifier string) bool {
+	version, err := h.countryServices.GetCountryVersion(identifier)
+	if err != nil {
+		// Not found and friends are reported by the full request
+		return false
+	}
+
+	etag := countryETag(version.ID, version.Version, c.Request.URL.Path, c.Request.URL.RawQuery, responseFormat(c))
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	c.Header("Vary", "Accept")
+	c.Header("Last-Modified", version.UpdatedAt.UTC().Format(http.TimeFormat))
+
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, etag) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !version.UpdatedAt.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// countryETag builds a strong ETag from a country's version and the request
+// parts that shape the response body. The id and version lead the tag so
+// If-Match can check them whichever representation the tag came from.
+func countryETag(id uint, version uint64, parts ...string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d|%d", id, version)
+	for _, part := range parts {
+		fmt.Fprintf(hash, "|%s", part)
+	}
+	return fmt.Sprintf(`"c%d-v%d-%s"`, id, version, hex.EncodeToString(hash.Sum(nil))[:16])
+}
+
+// setCountryETag tags the JSON response of a write with the new version
+func setCountryETag(c *gin.Context, country *dto.FilterCountriesResponse) {
+	c.Header("ETag", countryETag(country.ID, country.Version, "/countries/"+country.Slug, "", mimeJSON))
+}
+
+var countryETagPattern = regexp.MustCompile(`^"c(\d+)-v(\d+)(?:-[0-9a-f]+)?"$`)
+
+// requirePrecondition parses If-Match for a country write. Writes without
+// it are refused with 428 Precondition Required; it returns false then.
+// Weak tags never match, as If-Match uses strong comparison.
+func requirePrecondition(c *gin.Context) (services.Precondition, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"error": "If-Match header is required, use the ETag of the country",
+		})
+		return services.Precondition{}, false
+	}
+
+	var precondition services.Precondition
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			precondition.Any = true
+			continue
+		}
+		match := countryETagPattern.FindStringSubmatch(candidate)
+		if match == nil {
+			continue
+		}
+		id, idErr := strconv.ParseUint(match[1], 10, 64)
+		version, versionErr := strconv.ParseUint(match[2], 10, 64)
+		if idErr == nil && versionErr == nil {
+			precondition.Versions = append(precondition.Versions, dto.CountryVersion{ID: uint(id), Version: version})
+		}
+	}
+	return precondition, true
+}
+
+// datasetETag builds a strong ETag from the dataset version and the request
+// parts that shape the response body
+func datasetETag(version uint64, lastModified time.Time, parts ...string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d|%d", version, lastModified.UnixNano())
+	for _, part := range parts {
+		fmt.Fprintf(hash, "|%s", part)
+	}
+	return fmt.Sprintf(`"v%d-%s"`, version, hex.EncodeToString(hash.Sum(nil))[:16])
+}
+
+// etagMatches checks an If-None-Match header value against etag
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
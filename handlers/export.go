@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"task_2/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery is how many rows are written between flushes to the client
+const exportFlushEvery = 100
+
+// exportWriter streams export rows to the response. Headers are only sent
+// with the first row, so errors raised before any output can still be
+// reported as a normal JSON error.
+type exportWriter struct {
+	c       *gin.Context
+	format  string
+	started bool
+	gz      *gzip.Writer
+	out     io.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+	rows    int
+}
+
+func newExportWriter(c *gin.Context, format string) *exportWriter {
+	return &exportWriter{c: c, format: format}
+}
+
+func (e *exportWriter) start() {
+	e.started = true
+
+	extension := "ndjson"
+	if e.format == mimeCSV {
+		extension = "csv"
+	}
+	header := e.c.Writer.Header()
+	header.Set("Content-Type", e.format+"; charset=utf-8")
+	header.Set("Content-Disposition", `attachment; filename="countries.`+extension+`"`)
+	header.Add("Vary", "Accept-Encoding")
+
+	e.out = e.c.Writer
+	if acceptsGzip(e.c) {
+		header.Set("Content-Encoding", "gzip")
+		e.gz = gzip.NewWriter(e.c.Writer)
+		e.out = e.gz
+	}
+	e.csv = csv.NewWriter(e.out)
+	e.json = json.NewEncoder(e.out)
+
+	e.c.Status(http.StatusOK)
+	e.c.Writer.WriteHeaderNow()
+}
+
+func (e *exportWriter) write(record dto.ShapedCountry) error {
+	if !e.started {
+		e.start()
+	}
+
+	if e.format == mimeCSV {
+		if e.rows == 0 {
+			if err := e.csv.Write(record.Keys()); err != nil {
+				return err
+			}
+		}
+		row := make([]string, 0, len(record.Keys()))
+		for _, key := range record.Keys() {
+			value, _ := record.Get(key)
+			text, _, err := scalarText(value)
+			if err != nil {
+				return err
+			}
+			row = append(row, text)
+		}
+		if err := e.csv.Write(row); err != nil {
+			return err
+		}
+	} else if err := e.json.Encode(record); err != nil {
+		return err
+	}
+
+	e.rows++
+	if e.rows%exportFlushEvery == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() error {
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		return err
+	}
+	if e.gz != nil {
+		if err := e.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	e.c.Writer.Flush()
+	return nil
+}
+
+// close finishes the stream, sending the headers if no row was written
+func (e *exportWriter) close() error {
+	if !e.started {
+		e.start()
+	}
+	if err := e.flush(); err != nil {
+		return err
+	}
+	if e.gz != nil {
+		if err := e.gz.Close(); err != nil {
+			return err
+		}
+	}
+	e.c.Writer.Flush()
+	return nil
+}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding
+func acceptsGzip(c *gin.Context) bool {
+	for _, encoding := range strings.Split(c.GetHeader("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"task_2/dto"
 	"task_2/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,7 +38,7 @@ func NewCountryHandler(countryServices services.CountryService) *CountryHandler
 
 func (h CountryHandler) RefreshCountries(c *gin.Context) {
 	// Call the service straight away!!!
-	response, err := h.countryServices.RefreshCountries()
+	response, err := h.countryServices.RefreshCountries(c.Request.Context())
 	if err != nil {
 		handleError(err, c)
 		return
@@ -50,36 +57,557 @@ func (h CountryHandler) GetStatistics(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+func (h CountryHandler) GetRegions(c *gin.Context) {
+	regions, err := h.countryServices.GetRegions()
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, regions, "regions", "region")
+}
+
+func (h CountryHandler) GetRegionStats(c *gin.Context) {
+	region := c.Param("region")
+
+	stats, err := h.countryServices.GetRegionStats(region)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, stats, "regions", "region")
+}
+
+func (h CountryHandler) GetGroups(c *gin.Context) {
+	groups, err := h.countryServices.GetGroups()
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, groups, "groups", "group")
+}
+
+func (h CountryHandler) GetGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	group, err := h.countryServices.GetGroup(id)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h CountryHandler) CreateGroup(c *gin.Context) {
+	var request dto.GroupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"body": "must be a JSON group document"},
+		})
+		return
+	}
+
+	group, err := h.countryServices.CreateGroup(c.Request.Context(), request)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Header("Location", "/groups/"+strconv.FormatUint(uint64(group.ID), 10))
+	c.JSON(http.StatusCreated, group)
+}
+
+func (h CountryHandler) UpdateGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	var request dto.GroupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"body": "must be a JSON group document"},
+		})
+		return
+	}
+
+	group, err := h.countryServices.UpdateGroup(c.Request.Context(), id, request)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h CountryHandler) DeleteGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := h.countryServices.DeleteGroup(c.Request.Context(), id); err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h CountryHandler) GetGroupMembers(c *gin.Context) {
+	id := c.Param("id")
+	sort := c.Query("sort")
+
+	shape := parseShape(c)
+	countries, err := h.countryServices.GetGroupCountries(id, sort, shape)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, countries, "countries", "country", shape.Keys()...)
+}
+
+func (h CountryHandler) AddGroupMembers(c *gin.Context) {
+	id := c.Param("id")
+
+	var request dto.GroupMembersRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"countries": "is required"},
+		})
+		return
+	}
+
+	group, err := h.countryServices.AddGroupMembers(c.Request.Context(), id, request.Countries)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h CountryHandler) RemoveGroupMember(c *gin.Context) {
+	id := c.Param("id")
+	countryName := c.Param("country")
+
+	if err := h.countryServices.RemoveGroupMember(c.Request.Context(), id, countryName); err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h CountryHandler) GetGroupStats(c *gin.Context) {
+	id := c.Param("id")
+
+	stats, err := h.countryServices.GetGroupStats(id)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, stats, "groups", "group")
+}
+
+func (h CountryHandler) GetCurrencies(c *gin.Context) {
+	minCountries := 0
+	if rawMin := c.Query("min_countries"); rawMin != "" {
+		parsed, err := strconv.Atoi(rawMin)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "min_countries must be a non-negative integer",
+			})
+			return
+		}
+		minCountries = parsed
+	}
+
+	currencies, err := h.countryServices.GetCurrencies(minCountries)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, currencies)
+}
+
+func (h CountryHandler) GetCurrencyByCode(c *gin.Context) {
+	code := c.Param("code")
+
+	currency, err := h.countryServices.GetCurrencyByCode(code)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, currency)
+}
+
+func (h CountryHandler) GetCurrencyCountries(c *gin.Context) {
+	code := c.Param("code")
+	sort := c.Query("sort")
+
+	countries, err := h.countryServices.GetCurrencyCountries(code, sort, parseShape(c))
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, countries)
+}
+
+func (h CountryHandler) Convert(c *gin.Context) {
+	from := c.Query("from")
+	to := c.Query("to")
+
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "from and to currencies are required",
+		})
+		return
+	}
+
+	amount := 1.0
+	if rawAmount := c.Query("amount"); rawAmount != "" {
+		parsed, err := strconv.ParseFloat(rawAmount, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "amount must be a number",
+			})
+			return
+		}
+		amount = parsed
+	}
+
+	var asOf *time.Time
+	if rawAsOf := c.Query("as_of"); rawAsOf != "" {
+		parsed, err := parseAsOf(rawAsOf)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "as_of must be an RFC3339 timestamp or a YYYY-MM-DD date",
+			})
+			return
+		}
+		asOf = &parsed
+	}
+
+	conversion, err := h.countryServices.Convert(from, to, amount, asOf)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, conversion)
+}
+
+func (h CountryHandler) CompareCountries(c *gin.Context) {
+	names := splitList(c.Query("names"))
+
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No country names passed",
+		})
+		return
+	}
+
+	if c.Query("format") == "png" {
+		image, err := h.countryServices.CompareCountriesImage(names)
+		if err != nil {
+			handleError(err, c)
+			return
+		}
+		c.Data(http.StatusOK, "image/png", image)
+		return
+	}
+
+	comparison, err := h.countryServices.CompareCountries(names)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
+
+func (h CountryHandler) GetRankings(c *gin.Context) {
+	metric := c.Param("metric")
+
+	limit := 0
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	rankings, err := h.countryServices.GetRankings(metric, c.Query("scope"), c.Query("order"), c.Query("region"), limit)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, rankings, "rankings", "ranking")
+}
+
+func (h CountryHandler) GetAuditEvents(c *gin.Context) {
+	var since *time.Time
+	if rawSince := c.Query("since"); rawSince != "" {
+		parsed, err := parseAsOf(rawSince)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "since must be an RFC3339 timestamp or a YYYY-MM-DD date",
+			})
+			return
+		}
+		since = &parsed
+	}
+
+	limit := 0
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := h.countryServices.GetAuditEvents(c.Query("country"), c.Query("actor"), since, limit)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, events, "events", "event")
+}
+
+func (h CountryHandler) GetCountryRankings(c *gin.Context) {
+	countryName := c.Param("name")
+
+	rankings, err := h.countryServices.GetCountryRankings(countryName)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, rankings)
+}
+
+func (h CountryHandler) BatchLookup(c *gin.Context) {
+	var request dto.BatchLookupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	result, err := h.countryServices.BatchLookup(request.Names, request.Codes, parseShape(c))
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 func (h CountryHandler) GetCountryByName(c *gin.Context) {
 	countryName := c.Param("name")
 
-	if countryName == "" {
+	if countryName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No param passed",
+		})
+		return
+	}
+
+	// Names, ISO codes and non-canonical spellings redirect to the slug URL
+	slug, err := h.countryServices.CanonicalSlug(countryName)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+	if slug != "" && !strings.EqualFold(slug, countryName) {
+		redirectToCanonical(c, "/countries/"+url.PathEscape(slug))
+		return
+	}
+
+	if h.countryNotModified(c, countryName) {
+		return
+	}
+
+	countryData, err := h.countryServices.GetCountryByName(countryName, parseShape(c))
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+	respond(c, http.StatusOK, countryData, "countries", "country")
+}
+
+func (h CountryHandler) GetCountryByCode(c *gin.Context) {
+	code := c.Param("iso")
+
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No param passed",
+		})
+		return
+	}
+
+	if h.countryNotModified(c, code) {
+		return
+	}
+
+	countryData, err := h.countryServices.GetCountryByCode(code, parseShape(c))
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+	respond(c, http.StatusOK, countryData, "countries", "country")
+}
+
+func (h CountryHandler) GetAllCountries(c *gin.Context) {
+	region := c.Query("region")
+	currency := c.Query("currency")
+	sort := c.Query("sort")
+	group := c.Query("group")
+
+	if h.notModified(c) {
+		return
+	}
+
+	shape := parseShape(c)
+	countries, err := h.countryServices.GetAllCountries(region, currency, sort, group, parseMetadataFilter(c), shape)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, countries, "countries", "country", shape.Keys()...)
+}
+
+func (h CountryHandler) SearchCountries(c *gin.Context) {
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "No search query passed",
+		})
+		return
+	}
+
+	limit := 0
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	results, err := h.countryServices.SearchCountries(query, limit)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+func (h CountryHandler) CreateCountry(c *gin.Context) {
+	var request dto.CountryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"body": "must be a JSON country document"},
+		})
+		return
+	}
+
+	country, err := h.countryServices.CreateCountry(c.Request.Context(), request)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Header("Location", "/countries/"+url.PathEscape(country.Slug))
+	setCountryETag(c, country)
+	c.JSON(http.StatusCreated, country)
+}
+
+func (h CountryHandler) ReplaceCountry(c *gin.Context) {
+	countryName := c.Param("name")
+
+	var request dto.CountryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "No param passed",
+			"error":   "Validation failed",
+			"details": gin.H{"body": "must be a JSON country document"},
 		})
 		return
 	}
 
-	countryData, err := h.countryServices.GetCountryByName(countryName)
+	precondition, ok := requirePrecondition(c)
+	if !ok {
+		return
+	}
+
+	country, err := h.countryServices.ReplaceCountry(c.Request.Context(), countryName, precondition, request)
 	if err != nil {
 		handleError(err, c)
 		return
 	}
-	c.JSON(http.StatusOK, countryData)
+
+	setCountryETag(c, country)
+	c.JSON(http.StatusOK, country)
 }
 
-func (h CountryHandler) GetAllCountries(c *gin.Context) {
-	region := c.Query("region")
-	currency := c.Query("currency")
-	sort := c.Query("sort")
+// PatchCountry takes a JSON Merge Patch (RFC 7386). Plain application/json
+// is accepted too.
+func (h CountryHandler) PatchCountry(c *gin.Context) {
+	countryName := c.Param("name")
+
+	contentType := c.ContentType()
+	if contentType != "application/merge-patch+json" && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Content-Type must be application/merge-patch+json",
+		})
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"body": "must be a JSON object"},
+		})
+		return
+	}
+
+	precondition, ok := requirePrecondition(c)
+	if !ok {
+		return
+	}
 
-	countries, err := h.countryServices.GetAllCountries(region, currency, sort)
+	country, err := h.countryServices.PatchCountry(c.Request.Context(), countryName, precondition, patch)
 	if err != nil {
 		handleError(err, c)
 		return
 	}
 
-	c.JSON(http.StatusOK, countries)
+	setCountryETag(c, country)
+	c.JSON(http.StatusOK, country)
 }
 
 func (h CountryHandler) DeleteCountry(c *gin.Context) {
@@ -92,7 +620,12 @@ func (h CountryHandler) DeleteCountry(c *gin.Context) {
 		return
 	}
 
-	err := h.countryServices.DeleteCountryByName(countryName)
+	precondition, ok := requirePrecondition(c)
+	if !ok {
+		return
+	}
+
+	err := h.countryServices.DeleteCountryByName(c.Request.Context(), countryName, precondition)
 	if err != nil {
 		handleError(err, c)
 		return
@@ -101,21 +634,370 @@ func (h CountryHandler) DeleteCountry(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-func (h CountryHandler) GetSummaryImage(c *gin.Context) {
-	imagePath := "cache/summary.png"
+// BulkDeleteCountries deletes the countries matching the region, currency
+// and stale filters in two steps: without ?token= it only previews them and
+// returns the token that confirms the deletion.
+func (h CountryHandler) BulkDeleteCountries(c *gin.Context) {
+	filter := dto.BulkDeleteFilter{
+		Region:   c.Query("region"),
+		Currency: c.Query("currency"),
+	}
+	if stale := c.Query("stale"); stale != "" {
+		value, err := strconv.ParseBool(stale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": gin.H{"stale": "must be true or false"},
+			})
+			return
+		}
+		filter.Stale = value
+	}
 
-	// Check if the image file exists
-	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Summary image not found. Please refresh countries first.",
+	token := c.Query("token")
+	if token == "" {
+		preview, err := h.countryServices.PreviewBulkDelete(filter)
+		if err != nil {
+			handleError(err, c)
+			return
+		}
+		c.JSON(http.StatusOK, preview)
+		return
+	}
+
+	deletion, err := h.countryServices.ConfirmBulkDelete(c.Request.Context(), filter, token)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, deletion)
+}
+
+func (h CountryHandler) GetDeletions(c *gin.Context) {
+	deletions, err := h.countryServices.GetDeletions()
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, deletions, "deletions", "deletion")
+}
+
+func (h CountryHandler) RestoreDeletion(c *gin.Context) {
+	deletionID := c.Param("id")
+
+	restored, err := h.countryServices.RestoreDeletion(c.Request.Context(), deletionID)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
+
+func (h CountryHandler) GetAliases(c *gin.Context) {
+	countryName := c.Param("name")
+
+	aliases, err := h.countryServices.GetAliases(countryName)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, aliases)
+}
+
+func (h CountryHandler) AddAlias(c *gin.Context) {
+	countryName := c.Param("name")
+
+	var request dto.AddAliasRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"alias": "is required"},
+		})
+		return
+	}
+
+	alias, err := h.countryServices.AddAlias(c.Request.Context(), countryName, request.Alias)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusCreated, alias)
+}
+
+func (h CountryHandler) DeleteAlias(c *gin.Context) {
+	countryName := c.Param("name")
+	alias := c.Param("alias")
+
+	if err := h.countryServices.DeleteAlias(c.Request.Context(), countryName, alias); err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h CountryHandler) GetMetadata(c *gin.Context) {
+	countryName := c.Param("name")
+
+	metadata, err := h.countryServices.GetMetadata(countryName)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+func (h CountryHandler) SetMetadata(c *gin.Context) {
+	countryName := c.Param("name")
+	key := c.Param("key")
+
+	var request dto.MetadataRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"value": "is required"},
+		})
+		return
+	}
+
+	entry, created, err := h.countryServices.SetMetadata(c.Request.Context(), countryName, key, request.Value)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, entry)
+}
+
+func (h CountryHandler) DeleteMetadata(c *gin.Context) {
+	countryName := c.Param("name")
+	key := c.Param("key")
+
+	if err := h.countryServices.DeleteMetadata(c.Request.Context(), countryName, key); err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetOverrides lists active overrides of all countries, expired ones too
+// with ?expired=true.
+func (h CountryHandler) GetOverrides(c *gin.Context) {
+	includeExpired := c.Query("expired") == "true"
+
+	overrides, err := h.countryServices.GetOverrides(includeExpired)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, overrides, "overrides", "override")
+}
+
+func (h CountryHandler) GetCountryOverrides(c *gin.Context) {
+	countryName := c.Param("name")
+
+	overrides, err := h.countryServices.GetCountryOverrides(countryName)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	respond(c, http.StatusOK, overrides, "overrides", "override")
+}
+
+func (h CountryHandler) SetOverride(c *gin.Context) {
+	countryName := c.Param("name")
+	field := c.Param("field")
+
+	var request dto.OverrideRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": gin.H{"author": "is required"},
+		})
+		return
+	}
+
+	override, created, err := h.countryServices.SetOverride(c.Request.Context(), countryName, field, request)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, override)
+}
+
+func (h CountryHandler) DeleteOverride(c *gin.Context) {
+	countryName := c.Param("name")
+	field := c.Param("field")
+
+	if err := h.countryServices.DeleteOverride(c.Request.Context(), countryName, field); err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h CountryHandler) ExportCountries(c *gin.Context) {
+	format := responseFormat(c)
+	if format == mimeJSON {
+		format = mimeNDJSON
+	}
+	if format != mimeNDJSON && format != mimeCSV {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be ndjson or csv",
+		})
+		return
+	}
+
+	export := newExportWriter(c, format)
+	err := h.countryServices.ExportCountries(c.Query("region"), c.Query("currency"), parseShape(c), export.write)
+	if err != nil {
+		if !export.started {
+			handleError(err, c)
+			return
+		}
+		// The status line is gone already, all we can do is cut the stream short
+		log.Println("Export aborted because", err.Error())
+		c.Abort()
+		return
+	}
+
+	if err := export.close(); err != nil {
+		log.Println("Failed to finish export because", err.Error())
+	}
+}
+
+func (h CountryHandler) GetSummaryImage(c *gin.Context) {
+	opts := dto.SummaryImageOptions{
+		Metric: c.Query("metric"),
+		Region: c.Query("region"),
+		Theme:  c.Query("theme"),
+	}
+	validationDetails := gin.H{}
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{{"top", &opts.Top}, {"width", &opts.Width}, {"height", &opts.Height}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			validationDetails[param.name] = "must be a positive integer"
+			continue
+		}
+		*param.target = parsed
+	}
+	if scatter := c.Query("scatter"); scatter != "" {
+		value, err := strconv.ParseBool(scatter)
+		if err != nil {
+			validationDetails["scatter"] = "must be true or false"
+		}
+		opts.Scatter = value
+	}
+	if len(validationDetails) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": validationDetails,
 		})
 		return
 	}
 
+	imagePath, err := h.countryServices.GetSummaryImage(opts)
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	// Each set of options has its own file, replaced when the data changes.
+	// c.File answers If-None-Match and If-Modified-Since itself from the
+	// ETag header and the file's mtime.
+	info, err := os.Stat(imagePath)
+	if err == nil {
+		version := uint64(0)
+		if state, stateErr := h.countryServices.GetDatasetState(); stateErr == nil {
+			version = state.Version
+		}
+		c.Header("ETag", datasetETag(version, info.ModTime(), imagePath, fmt.Sprint(info.Size())))
+		c.Header("Cache-Control", cacheControl)
+	}
+
 	// Serve the image file
 	c.File(imagePath)
 }
 
+// redirectToCanonical sends a permanent redirect to path, keeping the query string
+func redirectToCanonical(c *gin.Context, path string) {
+	if c.Request.URL.RawQuery != "" {
+		path += "?" + c.Request.URL.RawQuery
+	}
+	c.Redirect(http.StatusMovedPermanently, path)
+}
+
+// parseAsOf accepts an RFC3339 timestamp or a date, which means the end of that day in UTC
+func parseAsOf(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// parseMetadataFilter collects the ?meta.key=value filters
+func parseMetadataFilter(c *gin.Context) map[string][]string {
+	meta := make(map[string][]string)
+	for param, values := range c.Request.URL.Query() {
+		if key, ok := strings.CutPrefix(param, "meta."); ok {
+			meta[key] = append(meta[key], values...)
+		}
+	}
+	return meta
+}
+
+// parseShape reads the fields, exclude, embed and currency_base query parameters
+func parseShape(c *gin.Context) dto.ShapeOptions {
+	return dto.ShapeOptions{
+		Fields:       splitList(c.Query("fields")),
+		Exclude:      splitList(c.Query("exclude")),
+		Embed:        splitList(c.Query("embed")),
+		CurrencyBase: c.Query("currency_base"),
+	}
+}
+
+// splitList splits a comma separated query value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func handleError(err error, c *gin.Context) error {
 	errString := err.Error()
 
@@ -141,10 +1023,47 @@ func handleError(err error, c *gin.Context) error {
 		return err
 	}
 
+	if notFoundErr, ok := err.(*services.NotFoundError); ok {
+		if len(notFoundErr.Suggestions) > 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":       notFoundErr.Message,
+				"suggestions": notFoundErr.Suggestions,
+			})
+			return err
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": notFoundErr.Message,
+		})
+		return err
+	}
+
 	if strings.Contains(errString, "Country not found") {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Country not found",
 		})
+		return err
+	}
+
+	if preconditionErr, ok := err.(*services.PreconditionFailedError); ok {
+		setCountryETag(c, &preconditionErr.Current)
+		c.JSON(http.StatusPreconditionFailed, preconditionErr.Current)
+		return err
+	}
+
+	if conflictErr, ok := err.(*services.ConflictError); ok {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   conflictErr.Message,
+			"details": conflictErr.Details,
+		})
+		return err
+	}
+
+	if disabledErr, ok := err.(*services.DisabledError); ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   disabledErr.Message,
+			"details": disabledErr.Details,
+		})
+		return err
 	}
 
 	c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error", "details": errString})
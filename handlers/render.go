@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response formats offered through the Accept header or ?format=
+const (
+	mimeJSON   = "application/json"
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+	mimeXML    = "application/xml"
+)
+
+var formatMimeTypes = map[string]string{
+	"json":   mimeJSON,
+	"csv":    mimeCSV,
+	"ndjson": mimeNDJSON,
+	"xml":    mimeXML,
+}
+
+// acceptMimeTypes maps the Accept media types offered to a response format
+var acceptMimeTypes = map[string]string{
+	mimeJSON:   mimeJSON,
+	mimeCSV:    mimeCSV,
+	mimeNDJSON: mimeNDJSON,
+	mimeXML:    mimeXML,
+	"text/xml": mimeXML,
+}
+
+// responseFormat picks the response MIME type from ?format= or, failing
+// that, the Accept header. JSON is the default.
+func responseFormat(c *gin.Context) string {
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		if mime, ok := formatMimeTypes[format]; ok {
+			return mime
+		}
+		return ""
+	}
+	return negotiateFormat(c.GetHeader("Accept"))
+}
+
+// negotiateFormat returns the format of an Accept header. Another format
+// than JSON is only picked when the client names it explicitly with the
+// highest quality in the header, so browsers, which accept XML below HTML,
+// and wildcards still get JSON.
+func negotiateFormat(accept string) string {
+	best := mimeJSON
+	bestQuality := 0.0
+	explicit := false
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(entry, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			quality = parsed
+		}
+		if quality <= 0 || quality < bestQuality {
+			continue
+		}
+
+		// An earlier entry of the same quality wins
+		format, offered := acceptMimeTypes[mediaType]
+		if quality > bestQuality {
+			bestQuality = quality
+			best = mimeJSON
+			explicit = offered
+			if offered {
+				best = format
+			}
+		} else if offered && !explicit {
+			best = format
+			explicit = true
+		}
+	}
+	return best
+}
+
+// respond writes data in the negotiated format. data is a slice of records
+// or a single record; listName and itemName name the XML elements. columns
+// is the CSV header of an empty list of records without a fixed layout,
+// such as shaped countries; other records take it from their type.
+// Columns follow the record field order. Nil values are null in NDJSON,
+// empty cells in CSV and empty elements marked nil="true" in XML. Nested
+// values are written as JSON text in CSV and XML.
+func respond(c *gin.Context, status int, data interface{}, listName string, itemName string, columns ...string) {
+	format := responseFormat(c)
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format must be one of json, csv, ndjson, xml",
+		})
+		return
+	}
+
+	if format == mimeJSON {
+		c.JSON(status, data)
+		return
+	}
+
+	items, isList := listItems(data)
+	var body []byte
+	var err error
+	switch format {
+	case mimeCSV:
+		if len(columns) == 0 {
+			columns = typeColumns(data)
+		}
+		body, err = encodeCSV(items, columns)
+	case mimeNDJSON:
+		body, err = encodeNDJSON(items)
+	case mimeXML:
+		body, err = encodeXML(items, isList, listName, itemName)
+	}
+	if err != nil {
+		handleError(err, c)
+		return
+	}
+
+	c.Data(status, format+"; charset=utf-8", body)
+}
+
+// listItems unpacks data into its elements, treating a non-slice as a list of one
+func listItems(data interface{}) ([]interface{}, bool) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return []interface{}{v.Interface()}, false
+	}
+
+	items := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		items = append(items, v.Index(i).Interface())
+	}
+	return items, true
+}
+
+// typeColumns lists the fields of the record type of data, so an empty list
+// still gets a CSV header
+func typeColumns(data interface{}) []string {
+	t := reflect.TypeOf(data)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := recordFields(reflect.New(t).Elem().Interface())
+	columns := make([]string, 0, len(fields))
+	for _, f := range fields {
+		columns = append(columns, f.name)
+	}
+	return columns
+}
+
+// orderedRecord is implemented by dto.ShapedCountry
+type orderedRecord interface {
+	Keys() []string
+	Get(key string) (interface{}, bool)
+}
+
+type field struct {
+	name  string
+	value interface{}
+}
+
+// recordFields flattens an item into its named fields, in order. Structs use
+// their json tags, with embedded structs inlined as encoding/json does.
+func recordFields(item interface{}) []field {
+	if record, ok := item.(orderedRecord); ok {
+		fields := make([]field, 0, len(record.Keys()))
+		for _, key := range record.Keys() {
+			value, _ := record.Get(key)
+			fields = append(fields, field{name: key, value: value})
+		}
+		return fields
+	}
+
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return []field{{name: "value", value: item}}
+	}
+
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			fields = append(fields, recordFields(v.Field(i).Interface())...)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fv := v.Field(i)
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		fields = append(fields, field{name: name, value: fv.Interface()})
+	}
+	return fields
+}
+
+// scalarText renders a value as cell text. ok is false for nil.
+func scalarText(value interface{}) (text string, ok bool, err error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "", false, nil
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true, nil
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "", false, nil
+		}
+	}
+
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", false, err
+	}
+	return string(encoded), true, nil
+}
+
+// encodeCSV writes items under a header row. An empty list writes just
+// columns as the header, so it can be told apart from a broken response.
+func encodeCSV(items []interface{}, columns []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if len(items) == 0 && len(columns) > 0 {
+		if err := w.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	for i, item := range items {
+		fields := recordFields(item)
+		if i == 0 {
+			header := make([]string, 0, len(fields))
+			for _, f := range fields {
+				header = append(header, f.name)
+			}
+			if err := w.Write(header); err != nil {
+				return nil, err
+			}
+		}
+
+		row := make([]string, 0, len(fields))
+		for _, f := range fields {
+			text, _, err := scalarText(f.value)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, text)
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func encodeNDJSON(items []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeXML(items []interface{}, isList bool, listName string, itemName string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if isList {
+		fmt.Fprintf(&buf, "<%s>", listName)
+	}
+
+	for _, item := range items {
+		fmt.Fprintf(&buf, "<%s>", itemName)
+		for _, f := range recordFields(item) {
+			text, ok, err := scalarText(f.value)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				fmt.Fprintf(&buf, `<%s nil="true"/>`, f.name)
+				continue
+			}
+			fmt.Fprintf(&buf, "<%s>", f.name)
+			if err := xml.EscapeText(&buf, []byte(text)); err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&buf, "</%s>", f.name)
+		}
+		fmt.Fprintf(&buf, "</%s>", itemName)
+	}
+
+	if isList {
+		fmt.Fprintf(&buf, "</%s>", listName)
+	}
+	return buf.Bytes(), nil
+}
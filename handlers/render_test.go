@@ -0,0 +1,69 @@
+package handlers
+
+import "testing"
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "no header", accept: "", want: mimeJSON},
+		{name: "wildcard", accept: "*/*", want: mimeJSON},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: mimeJSON},
+		{name: "json", accept: "application/json", want: mimeJSON},
+		{name: "csv", accept: "text/csv", want: mimeCSV},
+		{name: "ndjson", accept: "application/x-ndjson", want: mimeNDJSON},
+		{name: "text xml", accept: "text/xml", want: mimeXML},
+		{name: "explicit beats wildcard of same quality", accept: "*/*, text/csv", want: mimeCSV},
+		{name: "higher quality wins", accept: "application/xml;q=0.5, text/csv", want: mimeCSV},
+		{name: "first of same quality wins", accept: "text/csv, application/xml", want: mimeCSV},
+		{name: "lower quality than wildcard", accept: "text/csv;q=0.5, */*", want: mimeJSON},
+		{name: "zero quality", accept: "text/csv;q=0", want: mimeJSON},
+		{name: "unknown type", accept: "image/png", want: mimeJSON},
+		{name: "case and spaces", accept: " Text/CSV ; Q=1 ", want: mimeCSV},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateFormat(tt.accept); got != tt.want {
+				t.Errorf("negotiateFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeCSVEmpty(t *testing.T) {
+	type ranking struct {
+		Rank  int     `json:"rank"`
+		Name  string  `json:"name"`
+		Value float64 `json:"value"`
+	}
+	tests := []struct {
+		name    string
+		data    interface{}
+		columns []string
+		want    string
+	}{
+		{name: "columns given", data: []interface{}{}, columns: []string{"id", "name"}, want: "id,name\n"},
+		{name: "columns from the record type", data: []ranking{}, want: "rank,name,value\n"},
+		{name: "columns from a pointer to the list", data: &[]ranking{}, want: "rank,name,value\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns := tt.columns
+			if len(columns) == 0 {
+				columns = typeColumns(tt.data)
+			}
+			items, _ := listItems(tt.data)
+			body, err := encodeCSV(items, columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("encodeCSV() = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"task_2/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActorAnonymous is the actor of requests without an API key
+const ActorAnonymous = "anonymous"
+
+// requestIDPattern limits caller supplied request IDs to what is safe to
+// store and log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestContext gives every request an ID, taken from X-Request-ID or
+// generated and echoed back, and an actor. Both are recorded with the
+// audit events of the request's writes.
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header("X-Request-ID", requestID)
+
+		ctx := repository.WithAuditContext(c.Request.Context(), repository.AuditContext{
+			Actor:     requestActor(c),
+			RequestID: requestID,
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestActor names the caller by a fingerprint of its API key, sent as
+// X-API-Key or a bearer token, so the key itself is never stored
+func requestActor(c *gin.Context) string {
+	key := c.GetHeader("X-API-Key")
+	if key == "" {
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return ActorAnonymous
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:])[:12]
+}
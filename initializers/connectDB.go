@@ -23,7 +23,7 @@ func AutoMigrate(db *gorm.DB) error {
 	if db == nil {
 		return errors.New("Database connection can't be nil")
 	}
-	err := db.AutoMigrate(&models.Country{})
+	err := db.AutoMigrate(&models.Country{}, &models.CountryAlias{}, &models.Currency{}, &models.ExchangeRateHistory{}, &models.DatasetVersion{}, &models.CountryOverride{}, &models.DeletedCountry{}, &models.CountryMetadata{}, &models.CountryGroup{}, &models.CountryGroupMember{}, &models.AuditEvent{})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// AuditEvent records one write to country data: who made it, what changed
+// and in which request. Events are only ever appended.
+type AuditEvent struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Actor       string    `gorm:"size:64;not null;index" json:"actor"`
+	Action      string    `gorm:"size:32;not null" json:"action"`
+	CountryID   *uint     `gorm:"index" json:"country_id"`
+	CountryName string    `gorm:"size:255;index" json:"country"`
+	RecordID    uint      `gorm:"not null" json:"record_id"`
+	Changes     string    `gorm:"type:text" json:"changes"`
+	RequestID   string    `gorm:"size:64;index" json:"request_id"`
+	CreatedAt   time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
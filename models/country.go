@@ -6,6 +6,9 @@ import "time"
 type Country struct {
 	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name            string    `gorm:"size:255;not null" json:"name"`
+	Alpha2Code      string    `gorm:"size:2;index" json:"alpha2_code"`
+	Alpha3Code      string    `gorm:"size:3;index" json:"alpha3_code"`
+	Slug            string    `gorm:"size:255;index" json:"slug"`
 	Capital         string    `gorm:"size:255" json:"capital"`
 	Region          string    `gorm:"size:255" json:"region"`
 	Population      int64     `gorm:"not null" json:"population"`
@@ -14,6 +17,7 @@ type Country struct {
 	EstimatedGDP    *float64  `json:"estimated_gdp,omitempty"`
 	FlagURL         string    `gorm:"size:512" json:"flag_url"`
 	LastRefreshedAt time.Time `gorm:"autoUpdateTime" json:"last_refreshed_at"`
+	Version         uint64    `gorm:"not null;default:1" json:"version"`
 	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
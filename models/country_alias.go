@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Alias sources
+const (
+	AliasSourceUpstream = "upstream"
+	AliasSourceManual   = "manual"
+)
+
+// CountryAlias is an alternative name a country can be looked up by.
+// Deleted aliases are soft deleted so the refresh does not seed them again.
+type CountryAlias struct {
+	ID              uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CountryID       uint           `gorm:"not null;index" json:"country_id"`
+	Alias           string         `gorm:"size:255;not null" json:"alias"`
+	NormalizedAlias string         `gorm:"size:255;not null;uniqueIndex" json:"-"`
+	Source          string         `gorm:"size:20;not null" json:"source"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+}
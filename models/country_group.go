@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Group sources
+const (
+	GroupSourceSeed   = "seed"
+	GroupSourceManual = "manual"
+)
+
+// CountryGroup is a named set of countries, such as a trade bloc or a sales
+// region, that cuts across the single Region string. Deleted groups are soft
+// deleted so the refresh does not seed them again.
+type CountryGroup struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string         `gorm:"size:100;not null;uniqueIndex" json:"name"`
+	Description string         `gorm:"size:512" json:"description"`
+	Source      string         `gorm:"size:20;not null" json:"source"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// CountryGroupMember puts a country in a group. Removed members are soft
+// deleted so the refresh does not seed them again.
+type CountryGroupMember struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID   uint           `gorm:"not null;uniqueIndex:idx_group_member" json:"group_id"`
+	CountryID uint           `gorm:"not null;uniqueIndex:idx_group_member;index" json:"country_id"`
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Metadata value types
+const (
+	MetadataTypeString  = "string"
+	MetadataTypeNumber  = "number"
+	MetadataTypeBoolean = "boolean"
+)
+
+// CountryMetadata is a custom key-value pair attached to a country. Values
+// are stored as text with their type. Refreshes leave them untouched.
+type CountryMetadata struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CountryID uint      `gorm:"not null;uniqueIndex:idx_country_metadata_key" json:"country_id"`
+	Key       string    `gorm:"column:meta_key;size:64;not null;uniqueIndex:idx_country_metadata_key;index:idx_metadata_key_value" json:"key"`
+	Value     string    `gorm:"column:meta_value;size:1024;not null;index:idx_metadata_key_value,length:191" json:"value"`
+	Type      string    `gorm:"column:value_type;size:10;not null" json:"type"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (CountryMetadata) TableName() string {
+	return "country_metadata"
+}
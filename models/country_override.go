@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// CountryOverride replaces one field of a country with a hand-maintained
+// value. Refreshes apply it on top of the upstream data until it expires.
+// Values are stored as text; a nil Value clears the field.
+type CountryOverride struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CountryID     uint       `gorm:"not null;uniqueIndex:idx_country_override_field" json:"country_id"`
+	Field         string     `gorm:"size:64;not null;uniqueIndex:idx_country_override_field" json:"field"`
+	Value         *string    `gorm:"size:512" json:"value"`
+	UpstreamValue *string    `gorm:"size:512" json:"upstream_value"`
+	Author        string     `gorm:"size:255;not null" json:"author"`
+	Reason        string     `gorm:"size:1024" json:"reason"`
+	ExpiresAt     *time.Time `gorm:"index" json:"expires_at"`
+	// RestoredAt is set once an expired override's upstream value has been
+	// written back to the country
+	RestoredAt *time.Time `gorm:"index" json:"restored_at"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Active reports whether the override still applies at now
+func (o CountryOverride) Active(now time.Time) bool {
+	return o.ExpiresAt == nil || o.ExpiresAt.After(now)
+}
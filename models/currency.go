@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Currency is a currency seen in the upstream country data, with the latest
+// exchange rate against the base currency.
+type Currency struct {
+	Code         string    `gorm:"primaryKey;size:10" json:"code"`
+	Name         string    `gorm:"size:255" json:"name"`
+	Symbol       string    `gorm:"size:32" json:"symbol"`
+	ExchangeRate *float64  `json:"exchange_rate,omitempty"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
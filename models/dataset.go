@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// DatasetVersion is a single-row counter bumped on every data change. It
+// backs the ETags served by the read endpoints.
+type DatasetVersion struct {
+	ID            uint      `gorm:"primaryKey"`
+	Version       uint64    `gorm:"not null;default:0"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+	LastRefreshAt *time.Time
+}
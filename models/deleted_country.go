@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DeletedCountry keeps a deleted country, with its aliases and overrides,
+// so the deletion can be undone until ExpiresAt. Countries deleted together
+// share a DeletionID.
+type DeletedCountry struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	DeletionID string    `gorm:"size:32;not null;index" json:"deletion_id"`
+	CountryID  uint      `gorm:"not null" json:"country_id"`
+	Name       string    `gorm:"size:255;not null" json:"name"`
+	Snapshot   string    `gorm:"type:longtext;not null" json:"-"`
+	DeletedAt  time.Time `gorm:"not null" json:"deleted_at"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+}
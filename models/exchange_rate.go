@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ExchangeRateHistory is one exchange rate observation recorded on refresh.
+type ExchangeRateHistory struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CurrencyCode string    `gorm:"size:10;not null;index:idx_rate_history_code_time,priority:1" json:"currency_code"`
+	BaseCode     string    `gorm:"size:10;not null" json:"base_code"`
+	Rate         float64   `gorm:"not null" json:"rate"`
+	FetchedAt    time.Time `gorm:"not null;index:idx_rate_history_code_time,priority:2" json:"fetched_at"`
+}
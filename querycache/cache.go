@@ -0,0 +1,86 @@
+package querycache
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// QueryCache caches query results as JSON in a Store. Keys are prefixed with
+// a generation number, so Invalidate makes every existing entry unreachable
+// at once, whatever the store.
+type QueryCache struct {
+	store      Store
+	ttl        time.Duration
+	generation atomic.Uint64
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+}
+
+// Stats are the counters exposed on GET /cache/stats
+type Stats struct {
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Entries    int    `json:"entries"`
+	Generation uint64 `json:"generation"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+func New(store Store, ttl time.Duration) *QueryCache {
+	return &QueryCache{
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// Key joins the parts into a cache key for the current generation
+func (q *QueryCache) Key(parts ...interface{}) string {
+	texts := make([]string, 0, len(parts)+1)
+	texts = append(texts, fmt.Sprintf("g%d", q.generation.Load()))
+	for _, part := range parts {
+		// Quoted so a "|" inside a part can't shift the boundaries
+		texts = append(texts, strconv.Quote(fmt.Sprint(part)))
+	}
+	return strings.Join(texts, "|")
+}
+
+// Get decodes the entry under key into dest, reporting whether it was found
+func (q *QueryCache) Get(key string, dest interface{}) bool {
+	value, ok := q.store.Get(key)
+	if ok && json.Unmarshal(value, dest) == nil {
+		q.hits.Add(1)
+		return true
+	}
+	q.misses.Add(1)
+	return false
+}
+
+// Set stores value under key for the cache TTL
+func (q *QueryCache) Set(key string, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		log.Println("Failed to cache query result because", err.Error())
+		return
+	}
+	q.store.Set(key, encoded, q.ttl)
+}
+
+// Invalidate drops every cached entry
+func (q *QueryCache) Invalidate() {
+	q.generation.Add(1)
+	q.store.Clear()
+}
+
+func (q *QueryCache) Stats() Stats {
+	return Stats{
+		Hits:       q.hits.Load(),
+		Misses:     q.misses.Load(),
+		Entries:    q.store.Len(),
+		Generation: q.generation.Load(),
+		TTLSeconds: int64(q.ttl / time.Second),
+	}
+}
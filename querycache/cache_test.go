@@ -0,0 +1,72 @@
+package querycache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryCacheCounters(t *testing.T) {
+	tests := []struct {
+		name       string
+		set        bool
+		invalidate bool
+		found      bool
+		wantHits   uint64
+		wantMisses uint64
+	}{
+		{name: "miss on an empty cache", wantMisses: 1},
+		{name: "hit after set", set: true, found: true, wantHits: 1},
+		{name: "miss after invalidate", set: true, invalidate: true, wantMisses: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := New(NewLRUStore(10), time.Minute)
+			key := cache.Key("countries", 1)
+			if tt.set {
+				cache.Set(key, []string{"Nigeria"})
+			}
+			if tt.invalidate {
+				cache.Invalidate()
+			}
+
+			var got []string
+			if found := cache.Get(key, &got); found != tt.found {
+				t.Fatalf("Get() found = %t, want %t", found, tt.found)
+			}
+			if tt.found && (len(got) != 1 || got[0] != "Nigeria") {
+				t.Errorf("Get() decoded %v", got)
+			}
+			stats := cache.Stats()
+			if stats.Hits != tt.wantHits || stats.Misses != tt.wantMisses {
+				t.Errorf("hits, misses = %d, %d, want %d, %d", stats.Hits, stats.Misses, tt.wantHits, tt.wantMisses)
+			}
+		})
+	}
+}
+
+func TestQueryCacheInvalidate(t *testing.T) {
+	cache := New(NewLRUStore(10), time.Minute)
+	before := cache.Key("stats")
+	cache.Set(before, 1)
+	cache.Invalidate()
+
+	stats := cache.Stats()
+	if stats.Entries != 0 {
+		t.Errorf("Entries = %d after Invalidate, want 0", stats.Entries)
+	}
+	if stats.Generation != 1 {
+		t.Errorf("Generation = %d after Invalidate, want 1", stats.Generation)
+	}
+	if after := cache.Key("stats"); after == before {
+		t.Errorf("Key() = %q both before and after Invalidate", after)
+	}
+}
+
+func TestQueryCacheKey(t *testing.T) {
+	cache := New(NewLRUStore(10), time.Minute)
+	// A "|" inside a part must not collide with two separate parts
+	if cache.Key("a|b") == cache.Key("a", "b") {
+		t.Error("Key() collides on a part containing the separator")
+	}
+}
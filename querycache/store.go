@@ -0,0 +1,95 @@
+package querycache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Store is the backing store of a QueryCache. Values are opaque bytes so a
+// shared store such as Redis can be plugged in later.
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	// Clear drops every entry. Stores shared between instances may treat it
+	// as a no-op since keys carry the cache generation.
+	Clear()
+	Len() int
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRUStore is an in-process Store that evicts the least recently used entry
+// once it holds capacity entries.
+type LRUStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func NewLRUStore(capacity int) *LRUStore {
+	return &LRUStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (s *LRUStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(element)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (s *LRUStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order.Init()
+	s.entries = make(map[string]*list.Element)
+}
+
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
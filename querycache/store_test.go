@@ -0,0 +1,119 @@
+package querycache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUStoreEviction(t *testing.T) {
+	type op struct {
+		get string
+		set string
+	}
+	tests := []struct {
+		name     string
+		capacity int
+		ops      []op
+		present  []string
+		evicted  []string
+	}{
+		{
+			name:     "evicts the oldest entry",
+			capacity: 2,
+			ops:      []op{{set: "a"}, {set: "b"}, {set: "c"}},
+			present:  []string{"b", "c"},
+			evicted:  []string{"a"},
+		},
+		{
+			name:     "get marks an entry as recently used",
+			capacity: 2,
+			ops:      []op{{set: "a"}, {set: "b"}, {get: "a"}, {set: "c"}},
+			present:  []string{"a", "c"},
+			evicted:  []string{"b"},
+		},
+		{
+			name:     "set on an existing key marks it as recently used",
+			capacity: 2,
+			ops:      []op{{set: "a"}, {set: "b"}, {set: "a"}, {set: "c"}},
+			present:  []string{"a", "c"},
+			evicted:  []string{"b"},
+		},
+		{
+			name:     "keeps every entry within capacity",
+			capacity: 3,
+			ops:      []op{{set: "a"}, {set: "b"}, {set: "c"}},
+			present:  []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewLRUStore(tt.capacity)
+			for _, o := range tt.ops {
+				if o.set != "" {
+					store.Set(o.set, []byte(o.set), time.Minute)
+				} else {
+					store.Get(o.get)
+				}
+			}
+
+			if got := store.Len(); got != len(tt.present) {
+				t.Errorf("Len() = %d, want %d", got, len(tt.present))
+			}
+			for _, key := range tt.present {
+				if value, ok := store.Get(key); !ok || string(value) != key {
+					t.Errorf("Get(%q) = %q, %t, want %q, true", key, value, ok, key)
+				}
+			}
+			for _, key := range tt.evicted {
+				if _, ok := store.Get(key); ok {
+					t.Errorf("Get(%q) found an evicted entry", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUStoreTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		found bool
+	}{
+		{name: "live entry", ttl: time.Minute, found: true},
+		{name: "expired entry", ttl: -time.Second, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewLRUStore(10)
+			store.Set("key", []byte("value"), tt.ttl)
+
+			if _, ok := store.Get("key"); ok != tt.found {
+				t.Errorf("Get() found = %t, want %t", ok, tt.found)
+			}
+			// Expired entries are dropped when read
+			wantLen := 0
+			if tt.found {
+				wantLen = 1
+			}
+			if got := store.Len(); got != wantLen {
+				t.Errorf("Len() = %d, want %d", got, wantLen)
+			}
+		})
+	}
+}
+
+func TestLRUStoreClear(t *testing.T) {
+	store := NewLRUStore(10)
+	store.Set("a", []byte("a"), time.Minute)
+	store.Set("b", []byte("b"), time.Minute)
+	store.Clear()
+
+	if got := store.Len(); got != 0 {
+		t.Errorf("Len() = %d after Clear, want 0", got)
+	}
+	if _, ok := store.Get("a"); ok {
+		t.Error("Get() found an entry after Clear")
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"task_2/models"
+
+	"gorm.io/gorm"
+)
+
+type aliasRepository struct {
+	db *gorm.DB
+}
+
+type AliasRepository interface {
+	GetAliasesForCountry(countryID uint) ([]models.CountryAlias, error)
+	GetAllAliases() ([]models.CountryAlias, error)
+	GetAliasByNormalized(normalizedAlias string) (*models.CountryAlias, error)
+	GetAliasesByNormalized(normalizedAliases []string) ([]models.CountryAlias, error)
+	SaveAlias(ctx context.Context, alias *models.CountryAlias) (*models.CountryAlias, error)
+	DeleteAlias(ctx context.Context, countryID uint, normalizedAlias string) error
+}
+
+func NewAliasRepository(db *gorm.DB) AliasRepository {
+	return &aliasRepository{
+		db: db,
+	}
+}
+
+func (r aliasRepository) GetAliasesForCountry(countryID uint) ([]models.CountryAlias, error) {
+	var aliases []models.CountryAlias
+	if err := r.db.Where("country_id = ?", countryID).Order("alias ASC").Find(&aliases).Error; err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (r aliasRepository) GetAllAliases() ([]models.CountryAlias, error) {
+	var aliases []models.CountryAlias
+	if err := r.db.Find(&aliases).Error; err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (r aliasRepository) GetAliasByNormalized(normalizedAlias string) (*models.CountryAlias, error) {
+	var alias models.CountryAlias
+	if err := r.db.Where("normalized_alias = ?", normalizedAlias).First(&alias).Error; err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
+
+func (r aliasRepository) GetAliasesByNormalized(normalizedAliases []string) ([]models.CountryAlias, error) {
+	var aliases []models.CountryAlias
+	if len(normalizedAliases) == 0 {
+		return aliases, nil
+	}
+	if err := r.db.Where("normalized_alias IN ?", normalizedAliases).Find(&aliases).Error; err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// SaveAlias inserts an alias, reviving a previously deleted row with the
+// same normalized form instead of tripping the unique index.
+func (r aliasRepository) SaveAlias(ctx context.Context, alias *models.CountryAlias) (*models.CountryAlias, error) {
+	db := r.db.WithContext(ctx)
+	var existing models.CountryAlias
+	err := db.Unscoped().Where("normalized_alias = ?", alias.NormalizedAlias).First(&existing).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err := db.Create(alias).Error; err != nil {
+			return nil, err
+		}
+		return alias, nil
+	}
+
+	err = db.Unscoped().Model(&existing).Updates(map[string]interface{}{
+		"country_id": alias.CountryID,
+		"alias":      alias.Alias,
+		"source":     alias.Source,
+		"deleted_at": nil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	existing.CountryID = alias.CountryID
+	existing.Alias = alias.Alias
+	existing.Source = alias.Source
+	existing.DeletedAt = gorm.DeletedAt{}
+	return &existing, nil
+}
+
+func (r aliasRepository) DeleteAlias(ctx context.Context, countryID uint, normalizedAlias string) error {
+	res := r.db.WithContext(ctx).Where("country_id = ? AND normalized_alias = ?", countryID, normalizedAlias).Delete(&models.CountryAlias{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
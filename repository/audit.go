@@ -0,0 +1,602 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"task_2/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ActorScheduler is the actor of writes made outside an HTTP request
+const ActorScheduler = "scheduler"
+
+// ErrAuditAppendOnly is returned for updates and deletes of audit events
+var ErrAuditAppendOnly = errors.New("audit events are append-only")
+
+// auditedTables maps the audited tables to the entity named in actions
+var auditedTables = map[string]string{
+	"countries":             "country",
+	"country_aliases":       "alias",
+	"country_overrides":     "override",
+	"country_metadata":      "metadata",
+	"country_groups":        "group",
+	"country_group_members": "group_member",
+}
+
+// auditIgnoredColumns are bookkeeping columns left out of field diffs
+var auditIgnoredColumns = map[string]bool{
+	"id":         true,
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+const (
+	auditEventsTable = "audit_events"
+	auditBeforeKey   = "audit:before"
+	auditBatchKey    = "audit:batch"
+	// onConflictClause is the name GORM files upsert clauses under
+	onConflictClause = "ON CONFLICT"
+)
+
+// AuditContext identifies who is writing. It travels in the context of
+// the GORM statement.
+type AuditContext struct {
+	Actor     string
+	RequestID string
+}
+
+type auditContextKey struct{}
+
+func WithAuditContext(ctx context.Context, audit AuditContext) context.Context {
+	return context.WithValue(ctx, auditContextKey{}, audit)
+}
+
+func auditContextFrom(ctx context.Context) AuditContext {
+	if ctx != nil {
+		if audit, ok := ctx.Value(auditContextKey{}).(AuditContext); ok {
+			return audit
+		}
+	}
+	return AuditContext{Actor: ActorScheduler}
+}
+
+// FieldChange is one changed column of an audited row
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// auditRow is an audited row as column values
+type auditRow struct {
+	id     uint
+	values map[string]interface{}
+}
+
+// RegisterAuditCallbacks records every create, update and delete of the
+// audited tables as audit events, in the same transaction as the write.
+// Rows are read before and after the write to diff them.
+func RegisterAuditCallbacks(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("audit:before_create", auditBeforeCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("audit:after_create", auditAfterCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("audit:before_update", auditBefore); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("audit:after_update", auditAfterUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("audit:before_delete", auditBefore); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("audit:after_delete", auditAfterDelete)
+}
+
+// auditedEntity returns the entity name of the statement's table
+func auditedEntity(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return "", false
+	}
+	entity, ok := auditedTables[db.Statement.Table]
+	return entity, ok
+}
+
+// auditBefore keeps the rows an update or delete is about to touch
+func auditBefore(db *gorm.DB) {
+	if db.Error == nil && db.Statement.Table == auditEventsTable {
+		db.AddError(ErrAuditAppendOnly)
+		return
+	}
+	if _, ok := auditedEntity(db); !ok {
+		return
+	}
+
+	rows, err := loadAuditRows(db, auditTargets(db))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+// auditBeforeCreate keeps the rows an upsert may conflict with. The IDs
+// GORM fills into an upsert batch are unreliable once rows are skipped, so
+// the rows are matched on their keys instead.
+func auditBeforeCreate(db *gorm.DB) {
+	if _, ok := auditedEntity(db); !ok {
+		return
+	}
+	if _, ok := db.Statement.Clauses[onConflictClause]; !ok {
+		return
+	}
+
+	// Taken before the insert, which may fill in wrong IDs
+	batch := auditRowsOf(db, db.Statement.ReflectValue)
+	rows, err := loadConflictingRows(db, batch)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(auditBatchKey, batch)
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+func auditAfterCreate(db *gorm.DB) {
+	entity, ok := auditedEntity(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	if _, upsert := db.Statement.Clauses[onConflictClause]; upsert {
+		auditAfterUpsert(db, entity)
+		return
+	}
+
+	var rows []auditRow
+	var changes []map[string]FieldChange
+	for _, row := range auditRowsOf(db, db.Statement.ReflectValue) {
+		// Rows inserted already soft deleted, e.g. by a restore, add
+		// nothing visible
+		if row.values["deleted_at"] != nil {
+			continue
+		}
+		rows = append(rows, row)
+		changes = append(changes, diffAuditRows(nil, row.values))
+	}
+	recordAuditEvents(db, entity+".create", rows, changes)
+}
+
+// auditAfterUpsert records the rows of an upsert batch that were inserted
+// as creates and the existing rows it changed as updates. Rows skipped by
+// DO NOTHING are not recorded.
+func auditAfterUpsert(db *gorm.DB, entity string) {
+	before, _ := db.InstanceGet(auditBeforeKey)
+	beforeRows, _ := before.([]auditRow)
+	stored, _ := db.InstanceGet(auditBatchKey)
+	batch, _ := stored.([]auditRow)
+	afterRows, err := loadConflictingRows(db, batch)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	keys := auditKeys(db.Statement.Schema)
+	var created, updated []auditRow
+	var createdChanges, updatedChanges []map[string]FieldChange
+	seen := make(map[uint]bool)
+	for _, row := range batch {
+		after, ok := matchAuditRow(row, afterRows, keys)
+		if !ok || seen[after.id] {
+			continue
+		}
+		seen[after.id] = true
+
+		previous, existed := matchAuditRow(row, beforeRows, keys)
+		if !existed {
+			if after.values["deleted_at"] != nil {
+				continue
+			}
+			created = append(created, after)
+			createdChanges = append(createdChanges, diffAuditRows(nil, after.values))
+			continue
+		}
+		if diff := diffAuditRows(previous.values, after.values); len(diff) > 0 {
+			updated = append(updated, after)
+			updatedChanges = append(updatedChanges, diff)
+		}
+	}
+	recordAuditEvents(db, entity+".create", created, createdChanges)
+	recordAuditEvents(db, entity+".update", updated, updatedChanges)
+}
+
+// auditKeys lists the column sets an insert can conflict on: the primary
+// key and every unique index
+func auditKeys(s *schema.Schema) [][]string {
+	var keys [][]string
+	if len(s.PrimaryFieldDBNames) > 0 {
+		keys = append(keys, s.PrimaryFieldDBNames)
+	}
+	for _, field := range s.Fields {
+		if field.Unique && field.DBName != "" {
+			keys = append(keys, []string{field.DBName})
+		}
+	}
+	for _, index := range s.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		columns := make([]string, 0, len(index.Fields))
+		for _, field := range index.Fields {
+			columns = append(columns, field.DBName)
+		}
+		keys = append(keys, columns)
+	}
+	return keys
+}
+
+// keyValues returns the values of row for key, or false when one is unset.
+// A zero primary key is unset too, since the database assigns it.
+func keyValues(row auditRow, key []string) ([]interface{}, bool) {
+	values := make([]interface{}, 0, len(key))
+	for _, column := range key {
+		value := row.values[column]
+		if value == nil || (column == "id" && reflect.ValueOf(value).IsZero()) {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+// loadConflictingRows loads the stored rows, deleted ones included, that
+// share a key with a row of batch
+func loadConflictingRows(db *gorm.DB, batch []auditRow) ([]auditRow, error) {
+	keys := auditKeys(db.Statement.Schema)
+	var conditions []clause.Expression
+	for _, row := range batch {
+		for _, key := range keys {
+			values, ok := keyValues(row, key)
+			if !ok {
+				continue
+			}
+			match := make([]clause.Expression, len(key))
+			for i, column := range key {
+				match[i] = clause.Eq{Column: clause.Column{Name: column}, Value: values[i]}
+			}
+			conditions = append(conditions, clause.And(match...))
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	return loadAuditRows(db, auditSession(db).Unscoped().Where(clause.Or(conditions...)))
+}
+
+// matchAuditRow finds the stored row sharing a key with row
+func matchAuditRow(row auditRow, stored []auditRow, keys [][]string) (auditRow, bool) {
+	for _, key := range keys {
+		values, ok := keyValues(row, key)
+		if !ok {
+			continue
+		}
+		for _, candidate := range stored {
+			if candidateValues, ok := keyValues(candidate, key); ok && reflect.DeepEqual(values, candidateValues) {
+				return candidate, true
+			}
+		}
+	}
+	return auditRow{}, false
+}
+
+func auditAfterUpdate(db *gorm.DB) {
+	entity, ok := auditedEntity(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	before, _ := db.InstanceGet(auditBeforeKey)
+	beforeRows, _ := before.([]auditRow)
+	if len(beforeRows) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(beforeRows))
+	for _, row := range beforeRows {
+		ids = append(ids, row.id)
+	}
+	afterRows, err := loadAuditRows(db, auditSession(db).Where("id IN ?", ids))
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	afterByID := make(map[uint]auditRow, len(afterRows))
+	for _, row := range afterRows {
+		afterByID[row.id] = row
+	}
+
+	var rows []auditRow
+	var changes []map[string]FieldChange
+	for _, row := range beforeRows {
+		after, ok := afterByID[row.id]
+		if !ok {
+			continue
+		}
+		diff := diffAuditRows(row.values, after.values)
+		if len(diff) == 0 {
+			continue
+		}
+		rows = append(rows, after)
+		changes = append(changes, diff)
+	}
+	recordAuditEvents(db, entity+".update", rows, changes)
+}
+
+func auditAfterDelete(db *gorm.DB) {
+	entity, ok := auditedEntity(db)
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+	before, _ := db.InstanceGet(auditBeforeKey)
+	beforeRows, _ := before.([]auditRow)
+
+	var rows []auditRow
+	var changes []map[string]FieldChange
+	for _, row := range beforeRows {
+		// Purging soft deleted rows removes nothing that was visible
+		if row.values["deleted_at"] != nil {
+			continue
+		}
+		rows = append(rows, row)
+		changes = append(changes, diffAuditRows(row.values, nil))
+	}
+	recordAuditEvents(db, entity+".delete", rows, changes)
+}
+
+// auditSession starts a query on the statement's table in the same
+// connection, and so the same transaction. Unscoped statements see soft
+// deleted rows here too.
+func auditSession(db *gorm.DB) *gorm.DB {
+	q := db.Session(&gorm.Session{NewDB: true}).Table(db.Statement.Table)
+	if db.Statement.Unscoped {
+		q = q.Unscoped()
+	}
+	return q
+}
+
+// auditTargets selects the rows matched by the statement's conditions and
+// by the primary key of its model. A statement without either matches
+// nothing here; GORM rejects it anyway.
+func auditTargets(db *gorm.DB) *gorm.DB {
+	stmt := db.Statement
+	q := auditSession(db)
+	conditions := false
+
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if expr, ok := where.Expression.(clause.Where); ok && len(expr.Exprs) > 0 {
+			q = q.Clauses(clause.Where{Exprs: expr.Exprs})
+			conditions = true
+		}
+	}
+	if primaryKey := stmt.Schema.PrioritizedPrimaryField; primaryKey != nil && stmt.ReflectValue.Kind() == reflect.Struct {
+		if value, zero := primaryKey.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			q = q.Where(clause.Eq{Column: clause.Column{Name: primaryKey.DBName}, Value: value})
+			conditions = true
+		}
+	}
+
+	if !conditions {
+		return q.Where("1 = 0")
+	}
+	return q
+}
+
+// loadAuditRows runs q into a slice of the statement's model
+func loadAuditRows(db *gorm.DB, q *gorm.DB) ([]auditRow, error) {
+	rows := reflect.New(reflect.SliceOf(db.Statement.Schema.ModelType))
+	if err := q.Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+	return auditRowsOf(db, rows.Elem()), nil
+}
+
+// auditRowsOf reads the column values of a model or slice of models
+func auditRowsOf(db *gorm.DB, value reflect.Value) []auditRow {
+	value = reflect.Indirect(value)
+	var rows []auditRow
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			rows = append(rows, auditRowsOf(db, value.Index(i))...)
+		}
+	case reflect.Struct:
+		row := auditRow{values: make(map[string]interface{})}
+		for _, field := range db.Statement.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			fieldValue, _ := field.ValueOf(db.Statement.Context, value)
+			row.values[field.DBName] = auditValue(fieldValue)
+		}
+		if id, ok := row.values["id"].(uint); ok {
+			row.id = id
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// auditValue dereferences pointers and formats times so values compare
+// and serialize plainly
+func auditValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	if deletedAt, ok := rv.Interface().(gorm.DeletedAt); ok {
+		if !deletedAt.Valid {
+			return nil
+		}
+		rv = reflect.ValueOf(deletedAt.Time)
+	}
+	if t, ok := rv.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return rv.Interface()
+}
+
+// diffAuditRows lists the changed columns; a nil side is a created or
+// deleted row
+func diffAuditRows(before map[string]interface{}, after map[string]interface{}) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for column, to := range after {
+		if auditIgnoredColumns[column] {
+			continue
+		}
+		from := before[column]
+		if before != nil && reflect.DeepEqual(from, to) {
+			continue
+		}
+		if before == nil && to == nil {
+			continue
+		}
+		changes[column] = FieldChange{From: from, To: to}
+	}
+	if after == nil {
+		for column, from := range before {
+			if !auditIgnoredColumns[column] && from != nil {
+				changes[column] = FieldChange{From: from}
+			}
+		}
+	}
+	return changes
+}
+
+// recordAuditEvents appends one event per row, naming the country each row
+// belongs to
+func recordAuditEvents(db *gorm.DB, action string, rows []auditRow, changes []map[string]FieldChange) {
+	if len(rows) == 0 {
+		return
+	}
+	audit := auditContextFrom(db.Statement.Context)
+	isCountry := db.Statement.Table == "countries"
+
+	names := make(map[uint]string)
+	var lookup []uint
+	for _, row := range rows {
+		if isCountry {
+			name, _ := row.values["name"].(string)
+			names[row.id] = name
+		} else if countryID, ok := row.values["country_id"].(uint); ok {
+			lookup = append(lookup, countryID)
+		}
+	}
+	if len(lookup) > 0 {
+		var countries []models.Country
+		err := db.Session(&gorm.Session{NewDB: true}).Select("id", "name").Where("id IN ?", lookup).Find(&countries).Error
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		for _, country := range countries {
+			names[country.ID] = country.Name
+		}
+	}
+
+	events := make([]models.AuditEvent, 0, len(rows))
+	for i, row := range rows {
+		encoded, err := json.Marshal(changes[i])
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		event := models.AuditEvent{
+			Actor:     audit.Actor,
+			Action:    action,
+			RecordID:  row.id,
+			Changes:   string(encoded),
+			RequestID: audit.RequestID,
+		}
+		countryID := row.id
+		if !isCountry {
+			countryID, _ = row.values["country_id"].(uint)
+		}
+		if countryID != 0 {
+			event.CountryID = &countryID
+			event.CountryName = names[countryID]
+		}
+		events = append(events, event)
+	}
+
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&events).Error; err != nil {
+		db.AddError(err)
+	}
+}
+
+// AuditFilter narrows GetAuditEvents. Zero values match everything.
+type AuditFilter struct {
+	CountryID   *uint
+	CountryName string
+	Actor       string
+	Since       *time.Time
+	Limit       int
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+type AuditRepository interface {
+	GetAuditEvents(filter AuditFilter) ([]models.AuditEvent, error)
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{
+		db: db,
+	}
+}
+
+// GetAuditEvents returns matching events, newest first. A country matches
+// by id or, for deleted countries, by the name recorded with the event.
+func (r auditRepository) GetAuditEvents(filter AuditFilter) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	q := r.db.Model(&models.AuditEvent{})
+
+	switch {
+	case filter.CountryID != nil && filter.CountryName != "":
+		q = q.Where("country_id = ? OR LOWER(country_name) = ?", *filter.CountryID, strings.ToLower(filter.CountryName))
+	case filter.CountryID != nil:
+		q = q.Where("country_id = ?", *filter.CountryID)
+	case filter.CountryName != "":
+		q = q.Where("LOWER(country_name) = ?", strings.ToLower(filter.CountryName))
+	}
+	if filter.Actor != "" {
+		q = q.Where("actor = ?", filter.Actor)
+	}
+	if filter.Since != nil {
+		q = q.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+
+	if err := q.Order("id DESC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"task_2/models"
+	"task_2/querycache"
+	"time"
+)
+
+// versionCheckInterval is how long the cached repository trusts the dataset
+// version it last read. Writes on this instance invalidate straight away;
+// writes on other instances are picked up within this interval.
+const versionCheckInterval = time.Second
+
+// cachedCountryRepository serves the read-heavy listing and aggregate
+// queries from a QueryCache and passes everything else through. Keys carry
+// the dataset version, so any refresh, delete or import that bumps it makes
+// earlier results unreachable.
+type cachedCountryRepository struct {
+	CountryRepository
+	cache    *querycache.QueryCache
+	datasets DatasetRepository
+
+	mu               sync.Mutex
+	version          uint64
+	versionCheckedAt time.Time
+}
+
+func NewCachedCountryRepository(repo CountryRepository, cache *querycache.QueryCache, datasets DatasetRepository) CountryRepository {
+	return &cachedCountryRepository{
+		CountryRepository: repo,
+		cache:             cache,
+		datasets:          datasets,
+	}
+}
+
+// datasetVersion returns the dataset version, reading it at most once per
+// versionCheckInterval.
+func (r *cachedCountryRepository) datasetVersion() (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.versionCheckedAt) < versionCheckInterval {
+		return r.version, nil
+	}
+	version, err := r.datasets.GetVersion()
+	if err != nil {
+		return 0, err
+	}
+	r.version = version
+	r.versionCheckedAt = time.Now()
+	return version, nil
+}
+
+// cachedQuery returns the cached result for parts, running load and caching
+// its result on a miss. Errors are never cached.
+func cachedQuery[T any](r *cachedCountryRepository, load func() (T, error), parts ...interface{}) (T, error) {
+	version, err := r.datasetVersion()
+	if err != nil {
+		return load()
+	}
+
+	key := r.cache.Key(append([]interface{}{"countries", version}, parts...)...)
+	var result T
+	if r.cache.Get(key, &result) {
+		return result, nil
+	}
+
+	result, err = load()
+	if err != nil {
+		return result, err
+	}
+	r.cache.Set(key, result)
+	return result, nil
+}
+
+// normalizeFilter folds a filter value the way MySQL compares it, so "Africa"
+// and "africa" share a cache entry.
+func normalizeFilter(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	return strings.ToLower(value)
+}
+
+// normalizeSort maps unknown sorts to the name order they fall back to
+func normalizeSort(sortBy string) string {
+	switch sortBy {
+	case "gdp_desc", "gdp_asc":
+		return sortBy
+	default:
+		return "name"
+	}
+}
+
+// normalizeColumns sorts and deduplicates the selected columns
+func normalizeColumns(columns []string) string {
+	unique := make(map[string]bool, len(columns))
+	normalized := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if !unique[column] {
+			unique[column] = true
+			normalized = append(normalized, column)
+		}
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, ",")
+}
+
+// normalizeMetadata renders a metadata filter with sorted keys and values
+func normalizeMetadata(meta MetadataFilter) string {
+	parts := make([]string, 0, len(meta))
+	for key, values := range meta {
+		sorted := make([]string, 0, len(values))
+		for _, value := range values {
+			sorted = append(sorted, strconv.Quote(value))
+		}
+		sort.Strings(sorted)
+		parts = append(parts, strconv.Quote(key)+"="+strings.Join(sorted, ","))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+func (r *cachedCountryRepository) GetAllCountries() (*[]models.Country, error) {
+	return cachedQuery(r, r.CountryRepository.GetAllCountries, "all")
+}
+
+func (r *cachedCountryRepository) GetAllCountriesWithFilters(region string, currency string, sort string, group uint, meta MetadataFilter, columns ...string) (*[]models.Country, error) {
+	load := func() (*[]models.Country, error) {
+		return r.CountryRepository.GetAllCountriesWithFilters(region, currency, sort, group, meta, columns...)
+	}
+	return cachedQuery(r, load, "filter", normalizeFilter(region), normalizeFilter(currency), normalizeSort(sort), group, normalizeMetadata(meta), normalizeColumns(columns))
+}
+
+func (r *cachedCountryRepository) GetStats() (int64, string, error) {
+	type stats struct {
+		Count           int64
+		LastRefreshedAt string
+	}
+	load := func() (stats, error) {
+		count, lastRefreshedAt, err := r.CountryRepository.GetStats()
+		return stats{Count: count, LastRefreshedAt: lastRefreshedAt}, err
+	}
+	result, err := cachedQuery(r, load, "stats")
+	return result.Count, result.LastRefreshedAt, err
+}
+
+func (r *cachedCountryRepository) GetRegionStats(region string) ([]CountryAggregate, error) {
+	load := func() ([]CountryAggregate, error) {
+		return r.CountryRepository.GetRegionStats(region)
+	}
+	return cachedQuery(r, load, "region_stats", normalizeFilter(region))
+}
+
+func (r *cachedCountryRepository) GetGroupStats(groupID uint) ([]CountryAggregate, error) {
+	load := func() ([]CountryAggregate, error) {
+		return r.CountryRepository.GetGroupStats(groupID)
+	}
+	return cachedQuery(r, load, "group_stats", groupID)
+}
+
+func (r *cachedCountryRepository) GetRankings(metric string, byRegion bool, descending bool, region string, limit int) ([]MetricRanking, error) {
+	load := func() ([]MetricRanking, error) {
+		return r.CountryRepository.GetRankings(metric, byRegion, descending, region, limit)
+	}
+	return cachedQuery(r, load, "rankings", metric, byRegion, descending, normalizeFilter(region), limit)
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"task_2/querycache"
+	"testing"
+	"time"
+)
+
+// fakeDatasetRepository keeps the dataset version in memory and runs its
+// onChange callbacks on every bump, like datasetRepository
+type fakeDatasetRepository struct {
+	DatasetRepository
+	version  uint64
+	onChange []func()
+}
+
+func (r *fakeDatasetRepository) GetVersion() (uint64, error) {
+	return r.version, nil
+}
+
+func (r *fakeDatasetRepository) BumpVersion() error {
+	r.version++
+	for _, callback := range r.onChange {
+		callback()
+	}
+	return nil
+}
+
+// countingCountryRepository answers GetStats with a count of its calls, so
+// a cached result shows as an unchanged count
+type countingCountryRepository struct {
+	CountryRepository
+	calls int64
+}
+
+func (r *countingCountryRepository) GetStats() (int64, string, error) {
+	r.calls++
+	return r.calls, "", nil
+}
+
+func TestCachedQueryInvalidation(t *testing.T) {
+	tests := []struct {
+		name string
+		// bump runs between the two reads
+		bump       func(repo *cachedCountryRepository, datasets *fakeDatasetRepository)
+		wantSecond int64
+		wantHits   uint64
+		wantMisses uint64
+	}{
+		{
+			name:       "second read is a hit",
+			bump:       func(*cachedCountryRepository, *fakeDatasetRepository) {},
+			wantSecond: 1,
+			wantHits:   1,
+			wantMisses: 1,
+		},
+		{
+			name: "bump on this instance invalidates",
+			bump: func(_ *cachedCountryRepository, datasets *fakeDatasetRepository) {
+				datasets.BumpVersion()
+			},
+			wantSecond: 2,
+			wantMisses: 2,
+		},
+		{
+			name: "bump on another instance is read after the check interval",
+			bump: func(repo *cachedCountryRepository, datasets *fakeDatasetRepository) {
+				datasets.version++
+				repo.versionCheckedAt = time.Now().Add(-versionCheckInterval)
+			},
+			wantSecond: 2,
+			wantMisses: 2,
+		},
+		{
+			name: "bump on another instance is not read within the check interval",
+			bump: func(_ *cachedCountryRepository, datasets *fakeDatasetRepository) {
+				datasets.version++
+			},
+			wantSecond: 1,
+			wantHits:   1,
+			wantMisses: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := querycache.New(querycache.NewLRUStore(10), time.Minute)
+			datasets := &fakeDatasetRepository{version: 1, onChange: []func(){cache.Invalidate}}
+			repo := NewCachedCountryRepository(&countingCountryRepository{}, cache, datasets).(*cachedCountryRepository)
+
+			if first, _, err := repo.GetStats(); err != nil || first != 1 {
+				t.Fatalf("first GetStats() = %d, %v, want 1, nil", first, err)
+			}
+			tt.bump(repo, datasets)
+			second, _, err := repo.GetStats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second != tt.wantSecond {
+				t.Errorf("second GetStats() = %d, want %d", second, tt.wantSecond)
+			}
+
+			stats := cache.Stats()
+			if stats.Hits != tt.wantHits || stats.Misses != tt.wantMisses {
+				t.Errorf("hits, misses = %d, %d, want %d, %d", stats.Hits, stats.Misses, tt.wantHits, tt.wantMisses)
+			}
+		})
+	}
+}
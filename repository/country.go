@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"task_2/models"
 	"time"
@@ -13,14 +15,22 @@ type countryRepository struct {
 }
 
 type CountryRepository interface {
-	CreateNewCountry(country *models.Country) (*models.Country, error)
-	GetCountryByName(countryName string) (*models.Country, error)
-	UpdateCountry(countryId uint, updateData *models.Country) error
-	DeleteCountryByName(countryName string) error
+	CreateNewCountry(ctx context.Context, country *models.Country) (*models.Country, error)
+	GetCountryByName(countryName string, columns ...string) (*models.Country, error)
+	GetCountryByID(countryId uint, columns ...string) (*models.Country, error)
+	FindCountries(lookup CountryLookup, columns ...string) ([]models.Country, error)
+	GetCountryBySlug(slug string, columns ...string) (*models.Country, error)
+	GetCountryByCode(code string, columns ...string) (*models.Country, error)
+	UpdateCountry(ctx context.Context, countryId uint, version uint64, updateData *models.Country) error
+	GetCountriesForDelete(filter DeleteFilter) ([]models.Country, error)
 	GetAllCountries() (*[]models.Country, error)
-	GetAllCountriesWithFilters(region string, currency string, sort string) (*[]models.Country, error)
+	GetAllCountriesWithFilters(region string, currency string, sort string, group uint, meta MetadataFilter, columns ...string) (*[]models.Country, error)
+	StreamCountries(region string, currency string, columns []string, fn func(models.Country) error) error
 	GetStats() (int64, string, error)
-	GetTopCountriesByGDP(limit int) ([]models.Country, error)
+	GetRegionStats(region string) ([]CountryAggregate, error)
+	GetGroupStats(groupID uint) ([]CountryAggregate, error)
+	GetRankings(metric string, byRegion bool, descending bool, region string, limit int) ([]MetricRanking, error)
+	GetCountryRankings(metric string, byRegion bool, countryIDs []uint) ([]MetricRanking, error)
 }
 
 func NewCountryRepository(db *gorm.DB) CountryRepository {
@@ -29,21 +39,117 @@ func NewCountryRepository(db *gorm.DB) CountryRepository {
 	}
 }
 
-func (r countryRepository) CreateNewCountry(country *models.Country) (*models.Country, error) {
-	if err := r.db.Create(country).Error; err != nil {
+func (r countryRepository) CreateNewCountry(ctx context.Context, country *models.Country) (*models.Country, error) {
+	if err := r.db.WithContext(ctx).Create(country).Error; err != nil {
 		return nil, err
 	}
 	return country, nil
 }
 
-func (r countryRepository) GetCountryByName(countryName string) (*models.Country, error) {
+// GetCountryByName looks a country up by name. When columns are given only
+// those are loaded.
+func (r countryRepository) GetCountryByName(countryName string, columns ...string) (*models.Country, error) {
 	var country models.Country
-	if err := r.db.Where("LOWER(name) = ?", strings.ToLower(countryName)).First(&country).Error; err != nil {
+	q := r.db
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	if err := q.Where("LOWER(name) = ?", strings.ToLower(countryName)).First(&country).Error; err != nil {
+		return nil, err
+	}
+	return &country, nil
+}
+
+func (r countryRepository) GetCountryByID(countryId uint, columns ...string) (*models.Country, error) {
+	var country models.Country
+	q := r.db
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	if err := q.Where("id = ?", countryId).First(&country).Error; err != nil {
+		return nil, err
+	}
+	return &country, nil
+}
+
+func (r countryRepository) GetCountryBySlug(slug string, columns ...string) (*models.Country, error) {
+	var country models.Country
+	q := r.db
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	if err := q.Where("slug = ?", strings.ToLower(slug)).First(&country).Error; err != nil {
 		return nil, err
 	}
 	return &country, nil
 }
 
+// GetCountryByCode looks a country up by its ISO 3166-1 alpha-2 or alpha-3 code
+func (r countryRepository) GetCountryByCode(code string, columns ...string) (*models.Country, error) {
+	var country models.Country
+	q := r.db
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+
+	code = strings.ToUpper(code)
+	switch len(code) {
+	case 2:
+		q = q.Where("alpha2_code = ?", code)
+	case 3:
+		q = q.Where("alpha3_code = ?", code)
+	default:
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if err := q.First(&country).Error; err != nil {
+		return nil, err
+	}
+	return &country, nil
+}
+
+// CountryLookup lists the keys to match in FindCountries. Names and slugs
+// are compared lower-cased, ISO codes upper-cased.
+type CountryLookup struct {
+	IDs    []uint
+	Names  []string
+	Slugs  []string
+	Alpha2 []string
+	Alpha3 []string
+}
+
+// FindCountries returns every country matching any of the lookup keys in a
+// single query.
+func (r countryRepository) FindCountries(lookup CountryLookup, columns ...string) ([]models.Country, error) {
+	var countries []models.Country
+
+	conditions := r.db.Where("1 = 0")
+	if len(lookup.IDs) > 0 {
+		conditions = conditions.Or("id IN ?", lookup.IDs)
+	}
+	if len(lookup.Names) > 0 {
+		conditions = conditions.Or("LOWER(name) IN ?", lookup.Names)
+	}
+	if len(lookup.Slugs) > 0 {
+		conditions = conditions.Or("slug IN ?", lookup.Slugs)
+	}
+	if len(lookup.Alpha2) > 0 {
+		conditions = conditions.Or("alpha2_code IN ?", lookup.Alpha2)
+	}
+	if len(lookup.Alpha3) > 0 {
+		conditions = conditions.Or("alpha3_code IN ?", lookup.Alpha3)
+	}
+
+	q := r.db.Model(&models.Country{})
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	if err := q.Where(conditions).Find(&countries).Error; err != nil {
+		return nil, err
+	}
+	return countries, nil
+}
+
 func (r countryRepository) GetAllCountries() (*[]models.Country, error) {
 	var countries []models.Country
 	if err := r.db.Find(&countries).Error; err != nil {
@@ -52,11 +158,15 @@ func (r countryRepository) GetAllCountries() (*[]models.Country, error) {
 	return &countries, nil
 }
 
-func (r countryRepository) GetAllCountriesWithFilters(region string, currency string, sort string) (*[]models.Country, error) {
+func (r countryRepository) GetAllCountriesWithFilters(region string, currency string, sort string, group uint, meta MetadataFilter, columns ...string) (*[]models.Country, error) {
 	var countries []models.Country
 
 	q := r.db.Model(&models.Country{})
 
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+
 	if strings.TrimSpace(region) != "" {
 		q = q.Where("region = ?", region)
 	}
@@ -65,6 +175,12 @@ func (r countryRepository) GetAllCountriesWithFilters(region string, currency st
 		q = q.Where("currency_code = ?", currency)
 	}
 
+	if group != 0 {
+		q = inGroup(q, group)
+	}
+
+	q = meta.apply(q)
+
 	switch sort {
 	case "gdp_desc":
 		q = q.Order("estimated_gdp DESC")
@@ -80,22 +196,92 @@ func (r countryRepository) GetAllCountriesWithFilters(region string, currency st
 	return &countries, nil
 }
 
-func (r countryRepository) UpdateCountry(countryId uint, updateData *models.Country) error {
-	res := r.db.Model(&models.Country{}).Where("id = ?", countryId).Updates(updateData)
+// StreamCountries walks the matching countries one row at a time through a
+// cursor, so memory use does not grow with the table. Iteration stops at
+// the first error returned by fn.
+func (r countryRepository) StreamCountries(region string, currency string, columns []string, fn func(models.Country) error) error {
+	q := r.db.Model(&models.Country{})
+
+	if len(columns) > 0 {
+		q = q.Select(columns)
+	}
+	if strings.TrimSpace(region) != "" {
+		q = q.Where("region = ?", region)
+	}
+	if strings.TrimSpace(currency) != "" {
+		q = q.Where("currency_code = ?", currency)
+	}
+
+	rows, err := q.Order("id ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var country models.Country
+		if err := r.db.ScanRows(rows, &country); err != nil {
+			return err
+		}
+		if err := fn(country); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ErrVersionConflict is returned by conditional writes when the country was
+// changed since the caller read it
+var ErrVersionConflict = errors.New("country version conflict")
+
+// UpdateCountry writes every field of updateData, zero values and NULLs
+// included, so it can clear a currency. The write only happens while the
+// stored version is still version; it then becomes version + 1.
+func (r countryRepository) UpdateCountry(ctx context.Context, countryId uint, version uint64, updateData *models.Country) error {
+	updateData.Version = version + 1
+	res := r.db.WithContext(ctx).Model(&models.Country{}).
+		Where("id = ? AND version = ?", countryId, version).
+		Select("*").Omit("id", "created_at").
+		Updates(updateData)
 	if res.Error != nil {
+		updateData.Version = version
 		return res.Error
 	}
 	if res.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		updateData.Version = version
+		return ErrVersionConflict
 	}
 	return nil
 }
 
-func (r countryRepository) DeleteCountryByName(countryName string) error {
-	if err := r.db.Where("LOWER(name) = ?", strings.ToLower(countryName)).Delete(&models.Country{}).Error; err != nil {
-		return err
+// DeleteFilter selects the countries of a bulk delete. Empty fields match
+// everything.
+type DeleteFilter struct {
+	Region   string
+	Currency string
+	// RefreshedBefore matches countries not updated since that time
+	RefreshedBefore *time.Time
+}
+
+// GetCountriesForDelete returns the countries matching filter, by id
+func (r countryRepository) GetCountriesForDelete(filter DeleteFilter) ([]models.Country, error) {
+	var countries []models.Country
+	q := r.db.Model(&models.Country{})
+
+	if strings.TrimSpace(filter.Region) != "" {
+		q = q.Where("region = ?", filter.Region)
 	}
-	return nil
+	if strings.TrimSpace(filter.Currency) != "" {
+		q = q.Where("currency_code = ?", filter.Currency)
+	}
+	if filter.RefreshedBefore != nil {
+		q = q.Where("last_refreshed_at < ?", *filter.RefreshedBefore)
+	}
+
+	if err := q.Order("id ASC").Find(&countries).Error; err != nil {
+		return nil, err
+	}
+	return countries, nil
 }
 
 func (r countryRepository) GetStats() (int64, string, error) {
@@ -127,14 +313,3 @@ func (r countryRepository) GetStats() (int64, string, error) {
 
 	return count, lastRefreshedStr, nil
 }
-
-func (r countryRepository) GetTopCountriesByGDP(limit int) ([]models.Country, error) {
-	var countries []models.Country
-	if err := r.db.Where("estimated_gdp IS NOT NULL").
-		Order("estimated_gdp DESC").
-		Limit(limit).
-		Find(&countries).Error; err != nil {
-		return nil, err
-	}
-	return countries, nil
-}
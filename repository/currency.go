@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"strings"
+	"task_2/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CurrencyUsage is a currency together with the number of countries using it.
+type CurrencyUsage struct {
+	models.Currency
+	CountryCount int64
+}
+
+type currencyRepository struct {
+	db *gorm.DB
+}
+
+type CurrencyRepository interface {
+	GetAllCurrencies(minCountries int) ([]CurrencyUsage, error)
+	GetCurrencyByCode(code string) (*CurrencyUsage, error)
+	GetCurrenciesByCodes(codes []string) ([]models.Currency, error)
+	GetRateAsOf(code string, baseCode string, asOf time.Time) (*models.ExchangeRateHistory, error)
+	GetRateHistory(codes []string, baseCode string, since time.Time) ([]models.ExchangeRateHistory, error)
+}
+
+func NewCurrencyRepository(db *gorm.DB) CurrencyRepository {
+	return &currencyRepository{
+		db: db,
+	}
+}
+
+func (r currencyRepository) usageQuery() *gorm.DB {
+	countries := r.db.Model(&models.Country{}).
+		Select("currency_code, COUNT(*) AS country_count").
+		Where("currency_code IS NOT NULL").
+		Group("currency_code")
+
+	return r.db.Model(&models.Currency{}).
+		Select("currencies.*, COALESCE(country_usage.country_count, 0) AS country_count").
+		Joins("LEFT JOIN (?) AS country_usage ON country_usage.currency_code = currencies.code", countries)
+}
+
+// GetAllCurrencies lists currencies used by at least minCountries countries,
+// most widely shared first.
+func (r currencyRepository) GetAllCurrencies(minCountries int) ([]CurrencyUsage, error) {
+	var currencies []CurrencyUsage
+	q := r.usageQuery()
+	if minCountries > 0 {
+		q = q.Where("COALESCE(country_usage.country_count, 0) >= ?", minCountries)
+	}
+	if err := q.Order("country_count DESC, currencies.code ASC").Scan(&currencies).Error; err != nil {
+		return nil, err
+	}
+	return currencies, nil
+}
+
+func (r currencyRepository) GetCurrencyByCode(code string) (*CurrencyUsage, error) {
+	var currencies []CurrencyUsage
+	err := r.usageQuery().
+		Where("currencies.code = ?", strings.ToUpper(code)).
+		Limit(1).
+		Scan(&currencies).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(currencies) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &currencies[0], nil
+}
+
+func (r currencyRepository) GetCurrenciesByCodes(codes []string) ([]models.Currency, error) {
+	var currencies []models.Currency
+	if len(codes) == 0 {
+		return currencies, nil
+	}
+	if err := r.db.Where("code IN ?", codes).Find(&currencies).Error; err != nil {
+		return nil, err
+	}
+	return currencies, nil
+}
+
+// GetRateAsOf returns the latest rate of a currency against baseCode recorded at or before asOf
+func (r currencyRepository) GetRateAsOf(code string, baseCode string, asOf time.Time) (*models.ExchangeRateHistory, error) {
+	var rate models.ExchangeRateHistory
+	err := r.db.Where("currency_code = ? AND base_code = ? AND fetched_at <= ?", strings.ToUpper(code), baseCode, asOf).
+		Order("fetched_at DESC").
+		First(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// GetRateHistory returns the rates against baseCode recorded since the given time, newest first
+func (r currencyRepository) GetRateHistory(codes []string, baseCode string, since time.Time) ([]models.ExchangeRateHistory, error) {
+	var history []models.ExchangeRateHistory
+	if len(codes) == 0 {
+		return history, nil
+	}
+	err := r.db.Where("currency_code IN ? AND base_code = ? AND fetched_at >= ?", codes, baseCode, since).
+		Order("currency_code ASC, fetched_at DESC").
+		Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
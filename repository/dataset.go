@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"task_2/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// datasetVersionID is the primary key of the single dataset_versions row
+const datasetVersionID = 1
+
+// DatasetState identifies the current state of the data for caching
+type DatasetState struct {
+	Version      uint64
+	LastModified time.Time
+}
+
+type datasetRepository struct {
+	db       *gorm.DB
+	onChange []func()
+}
+
+type DatasetRepository interface {
+	GetState() (*DatasetState, error)
+	GetVersion() (uint64, error)
+	GetLastRefresh() (*time.Time, error)
+	BumpVersion() error
+	NotifyChanged()
+}
+
+// NewDatasetRepository creates the repository. onChange callbacks run after
+// every version bump, e.g. to invalidate caches.
+func NewDatasetRepository(db *gorm.DB, onChange ...func()) DatasetRepository {
+	return &datasetRepository{
+		db:       db,
+		onChange: onChange,
+	}
+}
+
+// GetState returns the dataset version and the time anything last changed
+func (r datasetRepository) GetState() (*DatasetState, error) {
+	var version models.DatasetVersion
+	if err := r.db.Where("id = ?", datasetVersionID).Limit(1).Find(&version).Error; err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		UpdatedAt *time.Time
+	}
+	if err := r.db.Model(&models.Country{}).Select("MAX(updated_at) AS updated_at").Scan(&result).Error; err != nil {
+		return nil, err
+	}
+
+	state := &DatasetState{
+		Version:      version.Version,
+		LastModified: version.UpdatedAt,
+	}
+	if result.UpdatedAt != nil && result.UpdatedAt.After(state.LastModified) {
+		state.LastModified = *result.UpdatedAt
+	}
+	return state, nil
+}
+
+// GetVersion returns only the dataset version
+func (r datasetRepository) GetVersion() (uint64, error) {
+	var version models.DatasetVersion
+	if err := r.db.Select("version").Where("id = ?", datasetVersionID).Limit(1).Find(&version).Error; err != nil {
+		return 0, err
+	}
+	return version.Version, nil
+}
+
+// GetLastRefresh returns when the last successful refresh ran, nil if none has
+func (r datasetRepository) GetLastRefresh() (*time.Time, error) {
+	var version models.DatasetVersion
+	if err := r.db.Select("last_refresh_at").Where("id = ?", datasetVersionID).Limit(1).Find(&version).Error; err != nil {
+		return nil, err
+	}
+	return version.LastRefreshAt, nil
+}
+
+func (r datasetRepository) BumpVersion() error {
+	if err := BumpDatasetVersion(r.db); err != nil {
+		return err
+	}
+	r.NotifyChanged()
+	return nil
+}
+
+// NotifyChanged runs the onChange callbacks. Writes that bump the version
+// inside their own transaction call it once the transaction has committed.
+func (r datasetRepository) NotifyChanged() {
+	for _, fn := range r.onChange {
+		fn()
+	}
+}
+
+// BumpDatasetVersion increments the dataset version. It takes the handle to
+// run on so writes can bump it inside their own transaction.
+func BumpDatasetVersion(db *gorm.DB) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&models.DatasetVersion{ID: datasetVersionID, Version: 1}).Error
+}
+
+// RecordRefresh stores the time of a refresh. Call it after
+// BumpDatasetVersion, inside the refresh transaction.
+func RecordRefresh(db *gorm.DB, at time.Time) error {
+	return db.Model(&models.DatasetVersion{}).Where("id = ?", datasetVersionID).Update("last_refresh_at", at).Error
+}
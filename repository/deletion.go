@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"task_2/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeletionSummary describes one deletion kept for undo
+type DeletionSummary struct {
+	DeletionID   string
+	CountryCount int64
+	DeletedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type deletionRepository struct {
+	db *gorm.DB
+}
+
+type DeletionRepository interface {
+	GetDeletions() ([]DeletionSummary, error)
+	GetDeletedCountries(deletionID string) ([]models.DeletedCountry, error)
+	PurgeExpired(now time.Time) error
+}
+
+func NewDeletionRepository(db *gorm.DB) DeletionRepository {
+	return &deletionRepository{
+		db: db,
+	}
+}
+
+// GetDeletions lists the deletions that can still be undone, newest first
+func (r deletionRepository) GetDeletions() ([]DeletionSummary, error) {
+	var deletions []DeletionSummary
+	err := r.db.Model(&models.DeletedCountry{}).
+		Select("deletion_id, COUNT(*) AS country_count, MAX(deleted_at) AS deleted_at, MAX(expires_at) AS expires_at").
+		Group("deletion_id").
+		Order("deleted_at DESC").
+		Scan(&deletions).Error
+	if err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (r deletionRepository) GetDeletedCountries(deletionID string) ([]models.DeletedCountry, error) {
+	var countries []models.DeletedCountry
+	if err := r.db.Where("deletion_id = ?", deletionID).Order("name ASC").Find(&countries).Error; err != nil {
+		return nil, err
+	}
+	return countries, nil
+}
+
+// PurgeExpired drops deletions past their retention window
+func (r deletionRepository) PurgeExpired(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&models.DeletedCountry{}).Error
+}
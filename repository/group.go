@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"strings"
+	"task_2/models"
+
+	"gorm.io/gorm"
+)
+
+// inGroup limits a countries query to the current members of a group
+func inGroup(q *gorm.DB, groupID uint) *gorm.DB {
+	return q.Where("countries.id IN (SELECT country_id FROM country_group_members WHERE group_id = ? AND deleted_at IS NULL)", groupID)
+}
+
+type groupRepository struct {
+	db *gorm.DB
+}
+
+type GroupRepository interface {
+	GetGroups() ([]models.CountryGroup, error)
+	GetGroupByID(groupID uint) (*models.CountryGroup, error)
+	GetGroupByName(name string) (*models.CountryGroup, error)
+	CountMembers(groupIDs []uint) (map[uint]int64, error)
+}
+
+func NewGroupRepository(db *gorm.DB) GroupRepository {
+	return &groupRepository{
+		db: db,
+	}
+}
+
+func (r groupRepository) GetGroups() ([]models.CountryGroup, error) {
+	var groups []models.CountryGroup
+	if err := r.db.Order("name ASC").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r groupRepository) GetGroupByID(groupID uint) (*models.CountryGroup, error) {
+	var group models.CountryGroup
+	if err := r.db.First(&group, groupID).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (r groupRepository) GetGroupByName(name string) (*models.CountryGroup, error) {
+	var group models.CountryGroup
+	if err := r.db.Where("LOWER(name) = ?", strings.ToLower(name)).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CountMembers returns the member count of each group. Groups without
+// members are left out.
+func (r groupRepository) CountMembers(groupIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(groupIDs))
+	if len(groupIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		GroupID uint
+		Count   int64
+	}
+	err := r.db.Model(&models.CountryGroupMember{}).
+		Select("group_id, COUNT(*) AS count").
+		Where("group_id IN ?", groupIDs).
+		Group("group_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.GroupID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"sort"
+	"task_2/models"
+
+	"gorm.io/gorm"
+)
+
+// MetadataFilter maps metadata keys to the text values accepted for them.
+// A country matches when it has every key with one of its values.
+type MetadataFilter map[string][]string
+
+// apply adds the filter to a countries query
+func (f MetadataFilter) apply(q *gorm.DB) *gorm.DB {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		q = q.Where("EXISTS (SELECT 1 FROM country_metadata WHERE country_metadata.country_id = countries.id AND country_metadata.meta_key = ? AND country_metadata.meta_value IN ?)", key, f[key])
+	}
+	return q
+}
+
+type metadataRepository struct {
+	db *gorm.DB
+}
+
+type MetadataRepository interface {
+	GetMetadataForCountries(countryIDs []uint) ([]models.CountryMetadata, error)
+}
+
+func NewMetadataRepository(db *gorm.DB) MetadataRepository {
+	return &metadataRepository{
+		db: db,
+	}
+}
+
+func (r metadataRepository) GetMetadataForCountries(countryIDs []uint) ([]models.CountryMetadata, error) {
+	var metadata []models.CountryMetadata
+	if len(countryIDs) == 0 {
+		return metadata, nil
+	}
+	if err := r.db.Where("country_id IN ?", countryIDs).Order("meta_key ASC").Find(&metadata).Error; err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"task_2/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type overrideRepository struct {
+	db *gorm.DB
+}
+
+type OverrideRepository interface {
+	GetOverridesForCountries(countryIDs []uint) ([]models.CountryOverride, error)
+	GetAllOverrides() ([]models.CountryOverride, error)
+	GetOverride(countryID uint, field string) (*models.CountryOverride, error)
+	GetExpiredOverrides(now time.Time) ([]models.CountryOverride, error)
+}
+
+func NewOverrideRepository(db *gorm.DB) OverrideRepository {
+	return &overrideRepository{
+		db: db,
+	}
+}
+
+func (r overrideRepository) GetOverridesForCountries(countryIDs []uint) ([]models.CountryOverride, error) {
+	var overrides []models.CountryOverride
+	if len(countryIDs) == 0 {
+		return overrides, nil
+	}
+	if err := r.db.Where("country_id IN ?", countryIDs).Order("country_id ASC, field ASC").Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+func (r overrideRepository) GetAllOverrides() ([]models.CountryOverride, error) {
+	var overrides []models.CountryOverride
+	if err := r.db.Order("country_id ASC, field ASC").Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+func (r overrideRepository) GetOverride(countryID uint, field string) (*models.CountryOverride, error) {
+	var override models.CountryOverride
+	if err := r.db.Where("country_id = ? AND field = ?", countryID, field).First(&override).Error; err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// GetExpiredOverrides returns the overrides expired at now whose upstream
+// value has not been written back yet
+func (r overrideRepository) GetExpiredOverrides(now time.Time) ([]models.CountryOverride, error) {
+	var overrides []models.CountryOverride
+	if err := r.db.Where("expires_at <= ? AND restored_at IS NULL", now).Order("country_id ASC, field ASC").Find(&overrides).Error; err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"task_2/models"
+
+	"gorm.io/gorm"
+)
+
+// RankMetrics maps each rankable metric to the SQL expression computing it.
+var RankMetrics = map[string]string{
+	"population":     "population",
+	"estimated_gdp":  "estimated_gdp",
+	"gdp_per_capita": "estimated_gdp / NULLIF(population, 0)",
+	"exchange_rate":  "exchange_rate",
+}
+
+// RankMetricNames lists the rankable metrics in display order.
+var RankMetricNames = []string{"population", "estimated_gdp", "gdp_per_capita", "exchange_rate"}
+
+// MetricRanking is a country's position on one metric within its scope,
+// either all countries or its region. Countries without a value for the
+// metric are not ranked.
+type MetricRanking struct {
+	CountryID uint
+	Name      string
+	Region    string
+	Value     float64
+	// Rank leaves gaps after ties (1, 1, 3), DenseRank does not (1, 1, 2)
+	Rank      int64
+	DenseRank int64
+	// Percentile is the share of ranked countries with a value at or below this one
+	Percentile float64
+	Total      int64
+}
+
+// rankingQuery ranks every country with a value for metric. byRegion ranks
+// within each region instead of globally; descending ranks the highest
+// value first.
+func (r countryRepository) rankingQuery(metric string, byRegion bool, descending bool) *gorm.DB {
+	expr := RankMetrics[metric]
+	partition := ""
+	if byRegion {
+		partition = "PARTITION BY region "
+	}
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+
+	return r.db.Model(&models.Country{}).
+		Select("id AS country_id, name, region, " + expr + " AS value, " +
+			"RANK() OVER (" + partition + "ORDER BY " + expr + " " + direction + ") AS `rank`, " +
+			"DENSE_RANK() OVER (" + partition + "ORDER BY " + expr + " " + direction + ") AS dense_rank, " +
+			"ROW_NUMBER() OVER (" + partition + "ORDER BY " + expr + " " + direction + ", name ASC) AS row_num, " +
+			"CUME_DIST() OVER (" + partition + "ORDER BY " + expr + " ASC) * 100 AS percentile, " +
+			"COUNT(*) OVER (" + partition + ") AS total").
+		Where(expr + " IS NOT NULL")
+}
+
+// GetRankings returns the top limit countries on metric, per region when
+// byRegion is set. A non-empty region only keeps countries of that region,
+// ranked within the chosen scope.
+func (r countryRepository) GetRankings(metric string, byRegion bool, descending bool, region string, limit int) ([]MetricRanking, error) {
+	q := r.db.Table("(?) AS ranked", r.rankingQuery(metric, byRegion, descending))
+	if region != "" {
+		q = q.Where("LOWER(region) = LOWER(?)", region)
+	}
+	if byRegion {
+		q = q.Where("row_num <= ?", limit).Order("region ASC, row_num ASC")
+	} else {
+		q = q.Order("row_num ASC").Limit(limit)
+	}
+
+	var rankings []MetricRanking
+	if err := q.Scan(&rankings).Error; err != nil {
+		return nil, err
+	}
+	return rankings, nil
+}
+
+// GetCountryRankings returns the positions of the given countries on metric,
+// highest value first, globally or within their region.
+func (r countryRepository) GetCountryRankings(metric string, byRegion bool, countryIDs []uint) ([]MetricRanking, error) {
+	var rankings []MetricRanking
+	if len(countryIDs) == 0 {
+		return rankings, nil
+	}
+
+	err := r.db.Table("(?) AS ranked", r.rankingQuery(metric, byRegion, true)).
+		Where("country_id IN ?", countryIDs).
+		Scan(&rankings).Error
+	if err != nil {
+		return nil, err
+	}
+	return rankings, nil
+}
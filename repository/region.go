@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"task_2/models"
+
+	"gorm.io/gorm"
+)
+
+// CountryAggregate holds the aggregate statistics of one group of countries.
+type CountryAggregate struct {
+	GroupKey            string
+	CountryCount        int64
+	TotalPopulation     int64
+	MedianPopulation    *float64
+	TotalEstimatedGDP   *float64
+	MeanEstimatedGDP    *float64
+	MedianEstimatedGDP  *float64
+	GDPPerCapita        *float64
+	MissingExchangeRate int64
+	MissingCurrency     int64
+}
+
+// GetRegionStats aggregates countries per region. An empty region returns
+// every region, otherwise only the matching one (case-insensitive).
+func (r countryRepository) GetRegionStats(region string) ([]CountryAggregate, error) {
+	scope := func(q *gorm.DB) *gorm.DB {
+		if region != "" {
+			q = q.Where("LOWER(region) = LOWER(?)", region)
+		}
+		return q
+	}
+	return aggregateCountries(r.db, scope, "region")
+}
+
+// GetGroupStats aggregates the members of one group. A group without
+// members returns no rows.
+func (r countryRepository) GetGroupStats(groupID uint) ([]CountryAggregate, error) {
+	scope := func(q *gorm.DB) *gorm.DB {
+		return q.Joins("JOIN country_group_members ON country_group_members.country_id = countries.id AND country_group_members.deleted_at IS NULL").
+			Where("country_group_members.group_id = ?", groupID)
+	}
+	return aggregateCountries(r.db, scope, "country_group_members.group_id")
+}
+
+// aggregateCountries computes CountryAggregate rows grouped by groupExpr over
+// the countries selected by scope. Sums, means and missing counts come from
+// a plain GROUP BY; medians use window functions since MySQL has no MEDIAN.
+func aggregateCountries(db *gorm.DB, scope func(*gorm.DB) *gorm.DB, groupExpr string) ([]CountryAggregate, error) {
+	var aggregates []CountryAggregate
+	err := scope(db.Model(&models.Country{})).
+		Select(groupExpr + ` AS group_key,
+			COUNT(*) AS country_count,
+			COALESCE(SUM(population), 0) AS total_population,
+			SUM(estimated_gdp) AS total_estimated_gdp,
+			AVG(estimated_gdp) AS mean_estimated_gdp,
+			SUM(estimated_gdp) / NULLIF(SUM(CASE WHEN estimated_gdp IS NOT NULL THEN population END), 0) AS gdp_per_capita,
+			SUM(CASE WHEN exchange_rate IS NULL THEN 1 ELSE 0 END) AS missing_exchange_rate,
+			SUM(CASE WHEN currency_code IS NULL THEN 1 ELSE 0 END) AS missing_currency`).
+		Group(groupExpr).
+		Order("group_key ASC").
+		Scan(&aggregates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	populationMedians, err := medianBy(db, scope, groupExpr, "population")
+	if err != nil {
+		return nil, err
+	}
+	gdpMedians, err := medianBy(db, scope, groupExpr, "estimated_gdp")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range aggregates {
+		if median, ok := populationMedians[aggregates[i].GroupKey]; ok {
+			aggregates[i].MedianPopulation = &median
+		}
+		if median, ok := gdpMedians[aggregates[i].GroupKey]; ok {
+			aggregates[i].MedianEstimatedGDP = &median
+		}
+	}
+	return aggregates, nil
+}
+
+// medianBy returns the median of column per group, ignoring NULLs.
+func medianBy(db *gorm.DB, scope func(*gorm.DB) *gorm.DB, groupExpr string, column string) (map[string]float64, error) {
+	ranked := scope(db.Model(&models.Country{})).
+		Select(groupExpr+" AS group_key, "+column+" AS value, "+
+			"ROW_NUMBER() OVER (PARTITION BY "+groupExpr+" ORDER BY "+column+") AS rn, "+
+			"COUNT(*) OVER (PARTITION BY "+groupExpr+") AS cnt").
+		Where(column + " IS NOT NULL")
+
+	var rows []struct {
+		GroupKey string
+		Median   float64
+	}
+	err := db.Table("(?) AS ranked", ranked).
+		Select("group_key, AVG(value) AS median").
+		Where("rn IN (FLOOR((cnt + 1) / 2), FLOOR((cnt + 2) / 2))").
+		Group("group_key").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	medians := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		medians[row.GroupKey] = row.Median
+	}
+	return medians, nil
+}
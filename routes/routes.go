@@ -1,7 +1,9 @@
 package routes
 
 import (
+	"task_2/config"
 	"task_2/handlers"
+	"task_2/querycache"
 	"task_2/repository"
 	"task_2/services"
 
@@ -9,15 +11,82 @@ import (
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(router *gin.Engine, db *gorm.DB) {
+// SetupRoutes registers every endpoint and returns the country service so
+// the caller can run its background jobs.
+func SetupRoutes(router *gin.Engine, db *gorm.DB, cfg *config.Config) services.CountryService {
 	countryRepo := repository.NewCountryRepository(db)
-	countryServices := services.NewCountryService(countryRepo, db)
+	aliasRepo := repository.NewAliasRepository(db)
+	currencyRepo := repository.NewCurrencyRepository(db)
+	overrideRepo := repository.NewOverrideRepository(db)
+	deletionRepo := repository.NewDeletionRepository(db)
+	metadataRepo := repository.NewMetadataRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+
+	// Listing and aggregate queries are cached until the dataset changes
+	var queryCache *querycache.QueryCache
+	var datasetRepo repository.DatasetRepository
+	if cfg.CacheSize > 0 {
+		queryCache = querycache.New(querycache.NewLRUStore(cfg.CacheSize), cfg.CacheTTL)
+		datasetRepo = repository.NewDatasetRepository(db, queryCache.Invalidate)
+		countryRepo = repository.NewCachedCountryRepository(countryRepo, queryCache, datasetRepo)
+	} else {
+		datasetRepo = repository.NewDatasetRepository(db)
+	}
+
+	countryServices := services.NewCountryService(countryRepo, aliasRepo, currencyRepo, datasetRepo, overrideRepo, deletionRepo, metadataRepo, groupRepo, auditRepo, db, cfg.BaseCurrency, cfg.DeletionRetention, cfg.BulkDeleteSecret)
 	countryHandlers := handlers.NewCountryHandler(countryServices)
+	cacheHandlers := handlers.NewCacheHandler(queryCache)
+
+	// Every request gets an ID and an actor for the audit log
+	router.Use(handlers.RequestContext())
 
 	router.POST("/countries/refresh", countryHandlers.RefreshCountries)
+	router.POST("/countries/batch", countryHandlers.BatchLookup)
 	router.GET("/status", countryHandlers.GetStatistics)
+	router.GET("/cache/stats", cacheHandlers.GetStats)
+	router.GET("/regions", countryHandlers.GetRegions)
+	router.GET("/regions/:region/stats", countryHandlers.GetRegionStats)
+	router.GET("/groups", countryHandlers.GetGroups)
+	router.POST("/groups", countryHandlers.CreateGroup)
+	router.GET("/groups/:id", countryHandlers.GetGroup)
+	router.PUT("/groups/:id", countryHandlers.UpdateGroup)
+	router.DELETE("/groups/:id", countryHandlers.DeleteGroup)
+	router.GET("/groups/:id/members", countryHandlers.GetGroupMembers)
+	router.POST("/groups/:id/members", countryHandlers.AddGroupMembers)
+	router.DELETE("/groups/:id/members/:country", countryHandlers.RemoveGroupMember)
+	router.GET("/groups/:id/stats", countryHandlers.GetGroupStats)
+	router.GET("/currencies", countryHandlers.GetCurrencies)
+	router.GET("/currencies/:code", countryHandlers.GetCurrencyByCode)
+	router.GET("/currencies/:code/countries", countryHandlers.GetCurrencyCountries)
+	router.GET("/convert", countryHandlers.Convert)
+	router.GET("/rankings/:metric", countryHandlers.GetRankings)
+	router.GET("/export", countryHandlers.ExportCountries)
 	router.GET("/countries/image", countryHandlers.GetSummaryImage)
 	router.GET("/countries", countryHandlers.GetAllCountries)
+	router.POST("/countries", countryHandlers.CreateCountry)
+	router.DELETE("/countries", countryHandlers.BulkDeleteCountries)
+	router.GET("/deletions", countryHandlers.GetDeletions)
+	router.GET("/audit", countryHandlers.GetAuditEvents)
+	router.POST("/deletions/:id/restore", countryHandlers.RestoreDeletion)
+	router.GET("/countries/search", countryHandlers.SearchCountries)
+	router.GET("/countries/compare", countryHandlers.CompareCountries)
+	router.GET("/countries/code/:iso", countryHandlers.GetCountryByCode)
 	router.GET("/countries/:name", countryHandlers.GetCountryByName)
+	router.PUT("/countries/:name", countryHandlers.ReplaceCountry)
+	router.PATCH("/countries/:name", countryHandlers.PatchCountry)
 	router.DELETE("/countries/:name", countryHandlers.DeleteCountry)
+	router.GET("/countries/:name/rankings", countryHandlers.GetCountryRankings)
+	router.GET("/countries/:name/aliases", countryHandlers.GetAliases)
+	router.POST("/countries/:name/aliases", countryHandlers.AddAlias)
+	router.DELETE("/countries/:name/aliases/:alias", countryHandlers.DeleteAlias)
+	router.GET("/countries/:name/metadata", countryHandlers.GetMetadata)
+	router.PUT("/countries/:name/metadata/:key", countryHandlers.SetMetadata)
+	router.DELETE("/countries/:name/metadata/:key", countryHandlers.DeleteMetadata)
+	router.GET("/overrides", countryHandlers.GetOverrides)
+	router.GET("/countries/:name/overrides", countryHandlers.GetCountryOverrides)
+	router.PUT("/countries/:name/overrides/:field", countryHandlers.SetOverride)
+	router.DELETE("/countries/:name/overrides/:field", countryHandlers.DeleteOverride)
+
+	return countryServices
 }
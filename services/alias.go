@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ConflictError struct {
+	Message string
+	Details map[string]string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// seedAliases stores the upstream altSpellings of a country. Aliases that
+// already exist, including ones deleted by hand, are left untouched.
+func seedAliases(tx *gorm.DB, countryID uint, name string, altSpellings []string) error {
+	seen := map[string]bool{utils.NormalizeName(name): true}
+	var aliases []models.CountryAlias
+	for _, spelling := range altSpellings {
+		normalized := utils.NormalizeName(spelling)
+		if normalized == "" || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		aliases = append(aliases, models.CountryAlias{
+			CountryID:       countryID,
+			Alias:           strings.TrimSpace(spelling),
+			NormalizedAlias: normalized,
+			Source:          models.AliasSourceUpstream,
+		})
+	}
+
+	if len(aliases) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&aliases).Error
+}
+
+func (s countryService) GetAliases(name string) ([]dto.CountryAliasResponse, error) {
+	country, err := s.findCountry(name, "id")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+
+	aliases, err := s.aliasRepository.GetAliasesForCountry(country.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.CountryAliasResponse, 0, len(aliases))
+	for _, alias := range aliases {
+		res = append(res, toCountryAliasResponse(alias))
+	}
+	return res, nil
+}
+
+func (s countryService) AddAlias(ctx context.Context, name string, alias string) (*dto.CountryAliasResponse, error) {
+	normalized := utils.NormalizeName(alias)
+	if normalized == "" {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"alias": "is required"},
+		}
+	}
+
+	country, err := s.findCountry(name, "id", "name")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+
+	existing, err := s.aliasRepository.GetAliasByNormalized(normalized)
+	if err == nil {
+		if existing.CountryID == country.ID {
+			res := toCountryAliasResponse(*existing)
+			return &res, nil
+		}
+		owner, ownerErr := s.countryRepository.GetCountryByID(existing.CountryID, "id", "name")
+		if ownerErr != nil {
+			return nil, ownerErr
+		}
+		return nil, &ConflictError{
+			Message: "Alias already exists",
+			Details: map[string]string{"alias": fmt.Sprintf("already assigned to %s", owner.Name)},
+		}
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	saved, err := s.aliasRepository.SaveAlias(ctx, &models.CountryAlias{
+		CountryID:       country.ID,
+		Alias:           strings.TrimSpace(alias),
+		NormalizedAlias: normalized,
+		Source:          models.AliasSourceManual,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	res := toCountryAliasResponse(*saved)
+	return &res, nil
+}
+
+func (s countryService) DeleteAlias(ctx context.Context, name string, alias string) error {
+	country, err := s.findCountry(name, "id")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.countryNotFound(name)
+		}
+		return err
+	}
+
+	if err := s.aliasRepository.DeleteAlias(ctx, country.ID, utils.NormalizeName(alias)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &NotFoundError{Message: "Alias not found"}
+		}
+		return err
+	}
+	return s.datasetRepository.BumpVersion()
+}
+
+func toCountryAliasResponse(alias models.CountryAlias) dto.CountryAliasResponse {
+	return dto.CountryAliasResponse{
+		Alias:     alias.Alias,
+		Source:    alias.Source,
+		CreatedAt: alias.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func toAuditEventResponse(event models.AuditEvent) (dto.AuditEventResponse, error) {
+	changes := map[string]dto.AuditChange{}
+	if event.Changes != "" {
+		if err := json.Unmarshal([]byte(event.Changes), &changes); err != nil {
+			return dto.AuditEventResponse{}, err
+		}
+	}
+	return dto.AuditEventResponse{
+		ID:        event.ID,
+		Actor:     event.Actor,
+		Action:    event.Action,
+		CountryID: event.CountryID,
+		Country:   event.CountryName,
+		RecordID:  event.RecordID,
+		Changes:   changes,
+		RequestID: event.RequestID,
+		CreatedAt: event.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+// GetAuditEvents lists audit events, newest first. country may name a
+// deleted country, which is matched by the name recorded with its events.
+func (s countryService) GetAuditEvents(country string, actor string, since *time.Time, limit int) ([]dto.AuditEventResponse, error) {
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	filter := repository.AuditFilter{
+		Actor: strings.TrimSpace(actor),
+		Since: since,
+		Limit: limit,
+	}
+	if country = strings.TrimSpace(country); country != "" {
+		filter.CountryName = country
+		found, err := s.findCountry(country, "id", "name")
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			filter.CountryID = &found.ID
+			filter.CountryName = found.Name
+		}
+	}
+
+	events, err := s.auditRepository.GetAuditEvents(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		response, err := toAuditEventResponse(event)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, response)
+	}
+	return res, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"task_2/utils"
+)
+
+const maxBatchSize = 250
+
+// Reasons reported for batch misses
+const (
+	batchReasonBlank       = "blank identifier"
+	batchReasonInvalidCode = "not an ISO 3166-1 alpha-2 or alpha-3 code"
+	batchReasonNoName      = "no country matches this name, slug, alias or ISO code"
+	batchReasonNoCode      = "no country has this ISO code"
+)
+
+// BatchLookup resolves many countries at once. Names resolve like
+// GetCountryByName (name, slug, alias, ISO code); codes only match ISO
+// codes. Countries come back in request order without duplicates.
+func (s countryService) BatchLookup(names []string, codes []string, shape dto.ShapeOptions) (*dto.BatchLookupResponse, error) {
+	if len(names)+len(codes) == 0 {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"names": "names or codes are required"},
+		}
+	}
+	if len(names)+len(codes) > maxBatchSize {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"names": fmt.Sprintf("at most %d names and codes can be looked up at once", maxBatchSize)},
+		}
+	}
+
+	countryShape, err := s.resolveShape(shape)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect every key the identifiers could match
+	var lookup repository.CountryLookup
+	var normalizedNames []string
+	addCode := func(code string) {
+		code = strings.ToUpper(code)
+		if len(code) == 2 {
+			lookup.Alpha2 = append(lookup.Alpha2, code)
+		} else {
+			lookup.Alpha3 = append(lookup.Alpha3, code)
+		}
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		lookup.Names = append(lookup.Names, strings.ToLower(name))
+		lookup.Slugs = append(lookup.Slugs, utils.Slugify(name))
+		normalizedNames = append(normalizedNames, utils.NormalizeName(name))
+		if isCountryCode(name) {
+			addCode(name)
+		}
+	}
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if isCountryCode(code) {
+			addCode(code)
+		}
+	}
+
+	aliases, err := s.aliasRepository.GetAliasesByNormalized(normalizedNames)
+	if err != nil {
+		return nil, err
+	}
+	aliasCountry := make(map[string]uint, len(aliases))
+	for _, alias := range aliases {
+		aliasCountry[alias.NormalizedAlias] = alias.CountryID
+		lookup.IDs = append(lookup.IDs, alias.CountryID)
+	}
+
+	columns := countryShape.columns
+	if len(columns) > 0 {
+		columns = append(append([]string{}, columns...), "name", "slug", "alpha2_code", "alpha3_code")
+	}
+	countries, err := s.countryRepository.FindCountries(lookup, columns...)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.Country, len(countries))
+	byName := make(map[string]uint, len(countries))
+	bySlug := make(map[string]uint, len(countries))
+	byCode := make(map[string]uint, 2*len(countries))
+	for _, country := range countries {
+		byID[country.ID] = country
+		byName[strings.ToLower(country.Name)] = country.ID
+		if country.Slug != "" {
+			bySlug[country.Slug] = country.ID
+		}
+		if country.Alpha2Code != "" {
+			byCode[strings.ToUpper(country.Alpha2Code)] = country.ID
+		}
+		if country.Alpha3Code != "" {
+			byCode[strings.ToUpper(country.Alpha3Code)] = country.ID
+		}
+	}
+
+	res := &dto.BatchLookupResponse{NotFound: []dto.BatchMiss{}}
+	var found []models.Country
+	seen := make(map[uint]bool)
+	add := func(id uint) {
+		if !seen[id] {
+			seen[id] = true
+			found = append(found, byID[id])
+		}
+	}
+
+	// Same precedence as findCountry: name, slug, alias, ISO code
+	for _, name := range names {
+		trimmed := strings.TrimSpace(name)
+		if trimmed == "" {
+			res.NotFound = append(res.NotFound, dto.BatchMiss{Identifier: name, Reason: batchReasonBlank})
+			continue
+		}
+		if id, ok := byName[strings.ToLower(trimmed)]; ok {
+			add(id)
+		} else if id, ok := bySlug[utils.Slugify(trimmed)]; ok {
+			add(id)
+		} else if id, ok := aliasCountry[utils.NormalizeName(trimmed)]; ok && byID[id].ID != 0 {
+			add(id)
+		} else if id, ok := byCode[strings.ToUpper(trimmed)]; ok && isCountryCode(trimmed) {
+			add(id)
+		} else {
+			res.NotFound = append(res.NotFound, dto.BatchMiss{Identifier: name, Reason: batchReasonNoName})
+		}
+	}
+	for _, code := range codes {
+		trimmed := strings.TrimSpace(code)
+		switch {
+		case trimmed == "":
+			res.NotFound = append(res.NotFound, dto.BatchMiss{Identifier: code, Reason: batchReasonBlank})
+		case !isCountryCode(trimmed):
+			res.NotFound = append(res.NotFound, dto.BatchMiss{Identifier: code, Reason: batchReasonInvalidCode})
+		default:
+			if id, ok := byCode[strings.ToUpper(trimmed)]; ok {
+				add(id)
+			} else {
+				res.NotFound = append(res.NotFound, dto.BatchMiss{Identifier: code, Reason: batchReasonNoCode})
+			}
+		}
+	}
+
+	res.Countries, err = countryShape.apply(s, found)
+	if err != nil {
+		return nil, err
+	}
+	if res.Countries == nil {
+		res.Countries = []dto.ShapedCountry{}
+	}
+	return res, nil
+}
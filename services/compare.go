@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/utils"
+
+	"gorm.io/gorm"
+)
+
+const maxCompareCountries = 10
+
+// CompareCountries resolves each name like GetCountryByName and returns the
+// found countries side by side. Differences are measured against the first
+// country found. Names that do not resolve are listed in Missing.
+func (s countryService) CompareCountries(names []string) (*dto.CompareResponse, error) {
+	if len(names) == 0 {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"names": "is required"},
+		}
+	}
+	if len(names) > maxCompareCountries {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"names": fmt.Sprintf("at most %d countries can be compared", maxCompareCountries)},
+		}
+	}
+
+	res := &dto.CompareResponse{
+		Countries:   []dto.ComparedCountry{},
+		Differences: []dto.CountryDifference{},
+		Missing:     []dto.MissingCountry{},
+	}
+
+	var countries []models.Country
+	seen := make(map[uint]bool)
+	// Suggestion candidates are loaded at most once, on the first miss
+	var candidates *searchCandidates
+	for _, name := range names {
+		country, err := s.findCountry(name)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if candidates == nil {
+				if candidates, err = s.loadSearchCandidates(); err != nil {
+					return nil, err
+				}
+			}
+			res.Missing = append(res.Missing, dto.MissingCountry{
+				Name:        name,
+				Error:       "Country not found",
+				Suggestions: candidates.suggestions(name),
+			})
+			continue
+		}
+		if seen[country.ID] {
+			continue
+		}
+		seen[country.ID] = true
+		countries = append(countries, *country)
+	}
+
+	ranks, err := s.metricPositions(countries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, country := range countries {
+		res.Countries = append(res.Countries, dto.ComparedCountry{
+			FilterCountriesResponse: toFilterCountriesResponse(country),
+			GDPPerCapita:            gdpPerCapita(country),
+			Ranks:                   ranks[country.ID],
+		})
+	}
+
+	if len(countries) > 0 {
+		baseline := countries[0]
+		for _, country := range countries[1:] {
+			res.Differences = append(res.Differences, dto.CountryDifference{
+				Country:  country.Name,
+				Baseline: baseline.Name,
+				Metrics: map[string]dto.MetricDifference{
+					"population":     difference(floatPtr(float64(country.Population)), floatPtr(float64(baseline.Population))),
+					"estimated_gdp":  difference(country.EstimatedGDP, baseline.EstimatedGDP),
+					"gdp_per_capita": difference(gdpPerCapita(country), gdpPerCapita(baseline)),
+					"exchange_rate":  difference(country.ExchangeRate, baseline.ExchangeRate),
+				},
+			})
+		}
+	}
+
+	return res, nil
+}
+
+// CompareCountriesImage renders the comparison of the named countries as a PNG card
+func (s countryService) CompareCountriesImage(names []string) ([]byte, error) {
+	comparison, err := s.CompareCountries(names)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]utils.ComparisonEntry, 0, len(comparison.Countries))
+	for _, country := range comparison.Countries {
+		entries = append(entries, utils.ComparisonEntry{
+			Name:         country.Name,
+			Population:   country.Population,
+			EstimatedGDP: country.EstimatedGDP,
+			GDPPerCapita: country.GDPPerCapita,
+			ExchangeRate: country.ExchangeRate,
+			CurrencyCode: country.CurrencyCode,
+		})
+	}
+	var missing []string
+	for _, m := range comparison.Missing {
+		missing = append(missing, m.Name)
+	}
+
+	return utils.RenderComparisonImage(entries, missing, s.baseCurrency)
+}
+
+// metricPositions reduces countryRankings to the global and regional rank
+// of each country on every rankable metric.
+func (s countryService) metricPositions(countries []models.Country) (map[uint]map[string]dto.MetricPosition, error) {
+	rankings, err := s.countryRankings(countries)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[uint]map[string]dto.MetricPosition, len(rankings))
+	for countryID, metrics := range rankings {
+		positions[countryID] = make(map[string]dto.MetricPosition, len(metrics))
+		for metric, ranking := range metrics {
+			var position dto.MetricPosition
+			if ranking != nil && ranking.Global != nil {
+				position.Global = &ranking.Global.Rank
+			}
+			if ranking != nil && ranking.Region != nil {
+				position.Region = &ranking.Region.Rank
+			}
+			positions[countryID][metric] = position
+		}
+	}
+	return positions, nil
+}
+
+func gdpPerCapita(country models.Country) *float64 {
+	if country.EstimatedGDP == nil || country.Population == 0 {
+		return nil
+	}
+	return floatPtr(*country.EstimatedGDP / float64(country.Population))
+}
+
+// difference returns value - baseline, absolute and relative to the baseline
+func difference(value, baseline *float64) dto.MetricDifference {
+	var diff dto.MetricDifference
+	if value == nil || baseline == nil {
+		return diff
+	}
+	diff.Absolute = floatPtr(*value - *baseline)
+	if *baseline != 0 {
+		diff.Relative = floatPtr((*value - *baseline) / *baseline)
+	}
+	return diff
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
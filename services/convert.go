@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"task_2/dto"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Convert converts amount between two currencies by crossing through the
+// base currency. With asOf set, the latest recorded rates at that time are
+// used instead of the current ones.
+func (s countryService) Convert(from string, to string, amount float64, asOf *time.Time) (*dto.ConvertResponse, error) {
+	from = strings.ToUpper(strings.TrimSpace(from))
+	to = strings.ToUpper(strings.TrimSpace(to))
+
+	validationDetails := make(map[string]string)
+	fromRate, err := s.rateFor(from, asOf)
+	if err != nil {
+		var valErr *ValidationError
+		if !errors.As(err, &valErr) {
+			return nil, err
+		}
+		validationDetails["from"] = valErr.Details["currency"]
+	}
+	toRate, err := s.rateFor(to, asOf)
+	if err != nil {
+		var valErr *ValidationError
+		if !errors.As(err, &valErr) {
+			return nil, err
+		}
+		validationDetails["to"] = valErr.Details["currency"]
+	}
+	if len(validationDetails) > 0 {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+
+	// Rates are units per base currency, so from -> base -> to
+	rate := toRate.Rate / fromRate.Rate
+	res := &dto.ConvertResponse{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Result:    amount * rate,
+		Rate:      rate,
+		Base:      s.baseCurrency,
+		RatesUsed: []dto.ConversionRate{*fromRate, *toRate},
+	}
+	if asOf != nil {
+		res.AsOf = asOf.Format(time.RFC3339)
+	}
+	return res, nil
+}
+
+// rateFor returns the rate of code against the base currency. Unknown and
+// rateless currencies are reported as a ValidationError on "currency".
+func (s countryService) rateFor(code string, asOf *time.Time) (*dto.ConversionRate, error) {
+	if code == "" {
+		return nil, currencyError("is required")
+	}
+
+	currency, err := s.currencyRepository.GetCurrencyByCode(code)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if code == s.baseCurrency {
+			return &dto.ConversionRate{Code: code, Rate: 1}, nil
+		}
+		return nil, currencyError(fmt.Sprintf("unknown currency %s", code))
+	}
+
+	if asOf == nil {
+		if currency.ExchangeRate == nil || *currency.ExchangeRate <= 0 {
+			return nil, currencyError(fmt.Sprintf("no exchange rate available for %s", code))
+		}
+		return &dto.ConversionRate{
+			Code: currency.Code,
+			Rate: *currency.ExchangeRate,
+			AsOf: currency.UpdatedAt.Format(time.RFC3339),
+		}, nil
+	}
+
+	recorded, err := s.currencyRepository.GetRateAsOf(code, s.baseCurrency, *asOf)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, currencyError(fmt.Sprintf("no exchange rate recorded for %s at or before %s", code, asOf.Format(time.RFC3339)))
+		}
+		return nil, err
+	}
+	return &dto.ConversionRate{
+		Code: recorded.CurrencyCode,
+		Rate: recorded.Rate,
+		AsOf: recorded.FetchedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func currencyError(detail string) error {
+	return &ValidationError{
+		Message: "Validation failed",
+		Details: map[string]string{"currency": detail},
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"task_2/clients"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// upsertCurrencies stores every currency listed by the upstream countries,
+// keeping name and symbol which the countries table does not hold, and
+// appends the fetched rates to the rate history.
+func upsertCurrencies(tx *gorm.DB, countries []clients.Country, rates *clients.ExchangeRates, baseCode string, fetchedAt time.Time) error {
+	byCode := make(map[string]*models.Currency)
+	var currencies []*models.Currency
+	for _, country := range countries {
+		for _, c := range country.Currencies {
+			code := strings.ToUpper(strings.TrimSpace(c.Code))
+			if code == "" {
+				continue
+			}
+			if existing, ok := byCode[code]; ok {
+				if existing.Name == "" {
+					existing.Name = c.Name
+				}
+				if existing.Symbol == "" {
+					existing.Symbol = c.Symbol
+				}
+				continue
+			}
+
+			currency := &models.Currency{Code: code, Name: c.Name, Symbol: c.Symbol}
+			if r, ok := rates.Rates[code]; ok && r > 0 {
+				rateValue := r
+				currency.ExchangeRate = &rateValue
+			}
+			byCode[code] = currency
+			currencies = append(currencies, currency)
+		}
+	}
+
+	if len(currencies) == 0 {
+		return nil
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "symbol", "exchange_rate", "updated_at"}),
+	}).Create(&currencies).Error
+	if err != nil {
+		return err
+	}
+
+	if rates.BaseCode != "" {
+		baseCode = rates.BaseCode
+	}
+	var history []models.ExchangeRateHistory
+	for _, currency := range currencies {
+		if currency.ExchangeRate == nil {
+			continue
+		}
+		history = append(history, models.ExchangeRateHistory{
+			CurrencyCode: currency.Code,
+			BaseCode:     baseCode,
+			Rate:         *currency.ExchangeRate,
+			FetchedAt:    fetchedAt,
+		})
+	}
+	if len(history) == 0 {
+		return nil
+	}
+	return tx.Create(&history).Error
+}
+
+func (s countryService) GetCurrencies(minCountries int) ([]dto.CurrencyResponse, error) {
+	currencies, err := s.currencyRepository.GetAllCurrencies(minCountries)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.CurrencyResponse, 0, len(currencies))
+	for _, currency := range currencies {
+		res = append(res, toCurrencyResponse(currency))
+	}
+	return res, nil
+}
+
+func (s countryService) GetCurrencyByCode(code string) (*dto.CurrencyDetailResponse, error) {
+	currency, err := s.findCurrency(code)
+	if err != nil {
+		return nil, err
+	}
+
+	countries, err := s.countryRepository.GetAllCountriesWithFilters("", currency.Code, "", 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &dto.CurrencyDetailResponse{
+		CurrencyResponse: toCurrencyResponse(*currency),
+		Countries:        make([]dto.FilterCountriesResponse, 0, len(*countries)),
+	}
+	for _, country := range *countries {
+		res.Countries = append(res.Countries, toFilterCountriesResponse(country))
+	}
+	return res, nil
+}
+
+func (s countryService) GetCurrencyCountries(code string, sort string, shape dto.ShapeOptions) ([]dto.ShapedCountry, error) {
+	currency, err := s.findCurrency(code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetAllCountries("", currency.Code, sort, "", nil, shape)
+}
+
+func (s countryService) findCurrency(code string) (*repository.CurrencyUsage, error) {
+	currency, err := s.currencyRepository.GetCurrencyByCode(code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{Message: "Currency not found"}
+		}
+		return nil, err
+	}
+	return currency, nil
+}
+
+func toCurrencyResponse(currency repository.CurrencyUsage) dto.CurrencyResponse {
+	return dto.CurrencyResponse{
+		Code:         currency.Code,
+		Name:         currency.Name,
+		Symbol:       currency.Symbol,
+		ExchangeRate: currency.ExchangeRate,
+		CountryCount: currency.CountryCount,
+		UpdatedAt:    currency.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"task_2/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// bulkDeleteTokenTTL is how long a bulk delete preview can be confirmed
+const bulkDeleteTokenTTL = 15 * time.Minute
+
+// DisabledError is returned by features the server was started without the
+// configuration for
+type DisabledError struct {
+	Message string
+	Details map[string]string
+}
+
+func (e *DisabledError) Error() string {
+	return e.Message
+}
+
+// checkBulkDeleteEnabled fails unless a secret to sign tokens with is set
+func (s countryService) checkBulkDeleteEnabled() error {
+	if len(s.bulkDeleteSecret) > 0 {
+		return nil
+	}
+	return &DisabledError{
+		Message: "Bulk delete is disabled",
+		Details: map[string]string{"config": "set BULK_DELETE_SECRET to enable it"},
+	}
+}
+
+// deletedCountrySnapshot is what a DeletedCountry keeps to restore a country
+type deletedCountrySnapshot struct {
+	Country   models.Country              `json:"country"`
+	Aliases   []models.CountryAlias       `json:"aliases"`
+	Overrides []models.CountryOverride    `json:"overrides"`
+	Metadata  []models.CountryMetadata    `json:"metadata"`
+	Groups    []models.CountryGroupMember `json:"groups"`
+	// When the aliases and memberships deleted by hand were deleted, by row
+	// ID. The models leave DeletedAt out of their JSON, and without it a
+	// restore would bring these back live.
+	AliasesDeletedAt map[uint]time.Time `json:"aliases_deleted_at,omitempty"`
+	GroupsDeletedAt  map[uint]time.Time `json:"groups_deleted_at,omitempty"`
+}
+
+func newDeletionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// deleteCountries archives and deletes countries in one transaction. Each
+// country is only deleted at the version it was read with; otherwise the
+// whole deletion rolls back with repository.ErrVersionConflict.
+func (s countryService) deleteCountries(ctx context.Context, countries []models.Country) (*dto.DeletionResponse, error) {
+	deletionID, err := newDeletionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(s.deletionRetention)
+
+	names := make([]string, 0, len(countries))
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, country := range countries {
+			snapshot := deletedCountrySnapshot{Country: country}
+			// Deleted aliases and memberships are kept too, so they stay
+			// deleted after a restore and the refresh does not seed them
+			if err := tx.Unscoped().Where("country_id = ?", country.ID).Find(&snapshot.Aliases).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("country_id = ?", country.ID).Find(&snapshot.Overrides).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("country_id = ?", country.ID).Find(&snapshot.Metadata).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("country_id = ?", country.ID).Find(&snapshot.Groups).Error; err != nil {
+				return err
+			}
+			snapshot.AliasesDeletedAt = make(map[uint]time.Time)
+			for _, alias := range snapshot.Aliases {
+				if alias.DeletedAt.Valid {
+					snapshot.AliasesDeletedAt[alias.ID] = alias.DeletedAt.Time
+				}
+			}
+			snapshot.GroupsDeletedAt = make(map[uint]time.Time)
+			for _, member := range snapshot.Groups {
+				if member.DeletedAt.Valid {
+					snapshot.GroupsDeletedAt[member.ID] = member.DeletedAt.Time
+				}
+			}
+			encoded, err := json.Marshal(snapshot)
+			if err != nil {
+				return err
+			}
+
+			res := tx.Where("id = ? AND version = ?", country.ID, country.Version).Delete(&models.Country{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return repository.ErrVersionConflict
+			}
+			if err := tx.Unscoped().Where("country_id = ?", country.ID).Delete(&models.CountryAlias{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("country_id = ?", country.ID).Delete(&models.CountryOverride{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("country_id = ?", country.ID).Delete(&models.CountryMetadata{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("country_id = ?", country.ID).Delete(&models.CountryGroupMember{}).Error; err != nil {
+				return err
+			}
+
+			archived := models.DeletedCountry{
+				DeletionID: deletionID,
+				CountryID:  country.ID,
+				Name:       country.Name,
+				Snapshot:   string(encoded),
+				DeletedAt:  now,
+				ExpiresAt:  expiresAt,
+			}
+			if err := tx.Create(&archived).Error; err != nil {
+				return err
+			}
+			names = append(names, country.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	return &dto.DeletionResponse{
+		DeletionID:       deletionID,
+		Count:            len(names),
+		Countries:        names,
+		DeletedAt:        now.Format(time.RFC3339),
+		RecoverableUntil: expiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+// bulkDeleteSelection resolves a bulk delete filter to the matching countries
+func (s countryService) bulkDeleteSelection(filter dto.BulkDeleteFilter) ([]models.Country, error) {
+	if strings.TrimSpace(filter.Region) == "" && strings.TrimSpace(filter.Currency) == "" && !filter.Stale {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"filter": "at least one of region, currency or stale is required"},
+		}
+	}
+
+	deleteFilter := repository.DeleteFilter{
+		Region:   filter.Region,
+		Currency: filter.Currency,
+	}
+	if filter.Stale {
+		lastRefresh, err := s.datasetRepository.GetLastRefresh()
+		if err != nil {
+			return nil, err
+		}
+		// Without a refresh nothing counts as stale
+		deleteFilter.RefreshedBefore = &time.Time{}
+		if lastRefresh != nil {
+			deleteFilter.RefreshedBefore = lastRefresh
+		}
+	}
+	return s.countryRepository.GetCountriesForDelete(deleteFilter)
+}
+
+// bulkDeleteToken signs a filter, the countries it matched at their
+// versions and the time of the preview, so a confirmation only goes through
+// while it still selects the same, unedited countries. The token is the
+// issue time in Unix seconds and the signature, joined by a dot.
+func (s countryService) bulkDeleteToken(filter dto.BulkDeleteFilter, countries []models.Country, issuedAt int64) string {
+	mac := hmac.New(sha256.New, s.bulkDeleteSecret)
+	fmt.Fprintf(mac, "%d|%s|%s|%t", issuedAt, strings.ToLower(filter.Region), strings.ToUpper(filter.Currency), filter.Stale)
+	for _, country := range countries {
+		fmt.Fprintf(mac, "|%d:%d", country.ID, country.Version)
+	}
+	return strconv.FormatInt(issuedAt, 10) + "." + hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// PreviewBulkDelete returns what a filtered delete would remove, with the
+// token that confirms it
+func (s countryService) PreviewBulkDelete(filter dto.BulkDeleteFilter) (*dto.BulkDeletePreview, error) {
+	if err := s.checkBulkDeleteEnabled(); err != nil {
+		return nil, err
+	}
+	countries, err := s.bulkDeleteSelection(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(countries))
+	for _, country := range countries {
+		names = append(names, country.Name)
+	}
+	issuedAt := time.Now()
+	return &dto.BulkDeletePreview{
+		Token:     s.bulkDeleteToken(filter, countries, issuedAt.Unix()),
+		ExpiresAt: issuedAt.Add(bulkDeleteTokenTTL).Format(time.RFC3339),
+		Count:     len(countries),
+		Countries: names,
+	}, nil
+}
+
+// ConfirmBulkDelete deletes the countries of a preview
+func (s countryService) ConfirmBulkDelete(ctx context.Context, filter dto.BulkDeleteFilter, token string) (*dto.DeletionResponse, error) {
+	if err := s.checkBulkDeleteEnabled(); err != nil {
+		return nil, err
+	}
+	countries, err := s.bulkDeleteSelection(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkBulkDeleteToken(filter, countries, token, time.Now()); err != nil {
+		return nil, err
+	}
+
+	deletion, err := s.deleteCountries(ctx, countries)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, errSelectionChanged()
+	}
+	return deletion, err
+}
+
+func errSelectionChanged() error {
+	return &ConflictError{
+		Message: "Countries changed since the preview",
+		Details: map[string]string{"token": "does not match the current selection, preview again"},
+	}
+}
+
+// checkBulkDeleteToken fails with a ConflictError unless token was issued
+// for filter and exactly these countries at their current versions, and
+// has not expired at now
+func (s countryService) checkBulkDeleteToken(filter dto.BulkDeleteFilter, countries []models.Country, token string, now time.Time) error {
+	issued, _, _ := strings.Cut(token, ".")
+	issuedAt, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil || !hmac.Equal([]byte(token), []byte(s.bulkDeleteToken(filter, countries, issuedAt))) {
+		return errSelectionChanged()
+	}
+	if now.Sub(time.Unix(issuedAt, 0)) > bulkDeleteTokenTTL {
+		return &ConflictError{
+			Message: "Preview expired",
+			Details: map[string]string{"token": "has expired, preview again"},
+		}
+	}
+	return nil
+}
+
+// GetDeletions lists the deletions still within the retention window
+func (s countryService) GetDeletions() ([]dto.DeletionResponse, error) {
+	if err := s.deletionRepository.PurgeExpired(time.Now()); err != nil {
+		return nil, err
+	}
+
+	deletions, err := s.deletionRepository.GetDeletions()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.DeletionResponse, 0, len(deletions))
+	for _, deletion := range deletions {
+		res = append(res, dto.DeletionResponse{
+			DeletionID:       deletion.DeletionID,
+			Count:            int(deletion.CountryCount),
+			DeletedAt:        deletion.DeletedAt.Format(time.RFC3339),
+			RecoverableUntil: deletion.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	return res, nil
+}
+
+// RestoreDeletion brings back the countries of a deletion with their
+// aliases, overrides, metadata and group memberships. Countries whose name
+// has been taken again, e.g. by a refresh, are skipped; aliases claimed
+// meanwhile by other countries are dropped.
+func (s countryService) RestoreDeletion(ctx context.Context, deletionID string) (*dto.RestoreResponse, error) {
+	if err := s.deletionRepository.PurgeExpired(time.Now()); err != nil {
+		return nil, err
+	}
+
+	archived, err := s.deletionRepository.GetDeletedCountries(deletionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(archived) == 0 {
+		return nil, &NotFoundError{Message: "Deletion not found or past its retention window"}
+	}
+
+	res := &dto.RestoreResponse{
+		DeletionID: deletionID,
+		Restored:   []string{},
+		Skipped:    []dto.RestoreSkip{},
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, entry := range archived {
+			var snapshot deletedCountrySnapshot
+			if err := json.Unmarshal([]byte(entry.Snapshot), &snapshot); err != nil {
+				return err
+			}
+
+			var existing []models.Country
+			if err := tx.Select("id").Where("LOWER(name) = ?", strings.ToLower(entry.Name)).Limit(1).Find(&existing).Error; err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				res.Skipped = append(res.Skipped, dto.RestoreSkip{Name: entry.Name, Reason: "a country with this name exists"})
+				continue
+			}
+
+			country := snapshot.Country
+			country.Version++
+			if err := tx.Create(&country).Error; err != nil {
+				return err
+			}
+			for i, alias := range snapshot.Aliases {
+				snapshot.Aliases[i].NormalizedAlias = utils.NormalizeName(alias.Alias)
+				if at, ok := snapshot.AliasesDeletedAt[alias.ID]; ok {
+					snapshot.Aliases[i].DeletedAt = gorm.DeletedAt{Time: at, Valid: true}
+				}
+			}
+			if len(snapshot.Aliases) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&snapshot.Aliases).Error; err != nil {
+					return err
+				}
+			}
+			if len(snapshot.Overrides) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&snapshot.Overrides).Error; err != nil {
+					return err
+				}
+			}
+			if len(snapshot.Metadata) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&snapshot.Metadata).Error; err != nil {
+					return err
+				}
+			}
+			for i, member := range snapshot.Groups {
+				if at, ok := snapshot.GroupsDeletedAt[member.ID]; ok {
+					snapshot.Groups[i].DeletedAt = gorm.DeletedAt{Time: at, Valid: true}
+				}
+			}
+			if len(snapshot.Groups) > 0 {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&snapshot.Groups).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Delete(&entry).Error; err != nil {
+				return err
+			}
+			res.Restored = append(res.Restored, entry.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Restored) > 0 {
+		if err := s.datasetRepository.BumpVersion(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"task_2/dto"
+	"task_2/models"
+	"testing"
+	"time"
+)
+
+func TestCheckBulkDeleteToken(t *testing.T) {
+	service := countryService{bulkDeleteSecret: []byte("secret")}
+	filter := dto.BulkDeleteFilter{Region: "Africa", Stale: true}
+	countries := []models.Country{{ID: 1, Version: 3}, {ID: 2, Version: 1}}
+	issuedAt := time.Date(2025, 10, 25, 18, 0, 0, 0, time.UTC)
+	token := service.bulkDeleteToken(filter, countries, issuedAt.Unix())
+
+	tests := []struct {
+		name      string
+		service   countryService
+		filter    dto.BulkDeleteFilter
+		countries []models.Country
+		token     string
+		now       time.Time
+		// wantError is the ConflictError message, empty for a valid token
+		wantError string
+	}{
+		{
+			name:      "valid token",
+			service:   service,
+			filter:    filter,
+			countries: countries,
+			token:     token,
+			now:       issuedAt.Add(time.Minute),
+		},
+		{
+			name:      "filter compared case-insensitively",
+			service:   service,
+			filter:    dto.BulkDeleteFilter{Region: "africa", Stale: true},
+			countries: countries,
+			token:     token,
+			now:       issuedAt.Add(time.Minute),
+		},
+		{
+			name:      "tampered filter",
+			service:   service,
+			filter:    dto.BulkDeleteFilter{Region: "Europe", Stale: true},
+			countries: countries,
+			token:     token,
+			now:       issuedAt.Add(time.Minute),
+			wantError: "Countries changed since the preview",
+		},
+		{
+			name:      "changed country version",
+			service:   service,
+			filter:    filter,
+			countries: []models.Country{{ID: 1, Version: 4}, {ID: 2, Version: 1}},
+			token:     token,
+			now:       issuedAt.Add(time.Minute),
+			wantError: "Countries changed since the preview",
+		},
+		{
+			name:      "changed selection",
+			service:   service,
+			filter:    filter,
+			countries: countries[:1],
+			token:     token,
+			now:       issuedAt.Add(time.Minute),
+			wantError: "Countries changed since the preview",
+		},
+		{
+			name:      "expired token",
+			service:   service,
+			filter:    filter,
+			countries: countries,
+			token:     token,
+			now:       issuedAt.Add(bulkDeleteTokenTTL + time.Second),
+			wantError: "Preview expired",
+		},
+		{
+			name:      "issue time moved forward",
+			service:   service,
+			filter:    filter,
+			countries: countries,
+			token:     strconv.FormatInt(issuedAt.Add(time.Hour).Unix(), 10) + token[len(strconv.FormatInt(issuedAt.Unix(), 10)):],
+			now:       issuedAt.Add(time.Hour),
+			wantError: "Countries changed since the preview",
+		},
+		{
+			name:      "signed with another secret",
+			service:   countryService{bulkDeleteSecret: []byte("other")},
+			filter:    filter,
+			countries: countries,
+			token:     token,
+			now:       issuedAt.Add(time.Minute),
+			wantError: "Countries changed since the preview",
+		},
+		{
+			name:      "malformed token",
+			service:   service,
+			filter:    filter,
+			countries: countries,
+			token:     "not-a-token",
+			now:       issuedAt.Add(time.Minute),
+			wantError: "Countries changed since the preview",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.service.checkBulkDeleteToken(tt.filter, tt.countries, tt.token, tt.now)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("checkBulkDeleteToken() = %v, want nil", err)
+				}
+				return
+			}
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) || conflict.Message != tt.wantError {
+				t.Fatalf("checkBulkDeleteToken() = %v, want ConflictError %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestBulkDeleteDisabledWithoutSecret(t *testing.T) {
+	var disabled *DisabledError
+	if err := (countryService{}).checkBulkDeleteEnabled(); !errors.As(err, &disabled) {
+		t.Fatalf("checkBulkDeleteEnabled() = %v, want DisabledError", err)
+	}
+	if err := (countryService{bulkDeleteSecret: []byte("secret")}).checkBulkDeleteEnabled(); err != nil {
+		t.Fatalf("checkBulkDeleteEnabled() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"task_2/dto"
+	"task_2/models"
+)
+
+// exportBatchSize is how many streamed countries share one overrides and
+// metadata lookup
+const exportBatchSize = 500
+
+// ExportCountries streams every matching country to fn, shaped like the list
+// endpoint. Embeds are not supported on export.
+func (s countryService) ExportCountries(region string, currency string, shape dto.ShapeOptions, fn func(dto.ShapedCountry) error) error {
+	if len(shape.Embed) > 0 {
+		return &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"embed": "is not supported on export"},
+		}
+	}
+
+	countryShape, err := s.resolveShape(shape)
+	if err != nil {
+		return err
+	}
+
+	// Overrides and metadata are loaded per batch of streamed countries, so
+	// memory stays bounded by the batch rather than by the tables
+	batch := make([]models.Country, 0, exportBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		records, err := countryShape.apply(s, batch)
+		if err != nil {
+			return err
+		}
+		batch = batch[:0]
+		for _, record := range records {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = s.countryRepository.StreamCountries(region, currency, countryShape.columns, func(country models.Country) error {
+		batch = append(batch, country)
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
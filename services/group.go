@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// seedGroupsJSON lists well-known blocs by ISO alpha-3 member codes
+//
+//go:embed seed/groups.json
+var seedGroupsJSON []byte
+
+type seedGroup struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Members     []string `json:"members"`
+}
+
+var seedGroups = loadSeedGroups()
+
+func loadSeedGroups() []seedGroup {
+	var groups []seedGroup
+	if err := json.Unmarshal(seedGroupsJSON, &groups); err != nil {
+		panic("invalid seed/groups.json: " + err.Error())
+	}
+	return groups
+}
+
+const (
+	maxGroupNameLength        = 100
+	maxGroupDescriptionLength = 512
+)
+
+// seedCountryGroups creates the well-known blocs and adds the countries
+// whose alpha-3 code belongs to them. Seeded groups and members deleted by
+// hand stay deleted, and groups created by hand are left alone.
+func seedCountryGroups(tx *gorm.DB) error {
+	for _, seed := range seedGroups {
+		var group models.CountryGroup
+		err := tx.Unscoped().Where("LOWER(name) = ?", strings.ToLower(seed.Name)).First(&group).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			group = models.CountryGroup{
+				Name:        seed.Name,
+				Description: seed.Description,
+				Source:      models.GroupSourceSeed,
+			}
+			err = tx.Create(&group).Error
+		}
+		if err != nil {
+			return err
+		}
+		if group.DeletedAt.Valid || group.Source != models.GroupSourceSeed {
+			continue
+		}
+
+		var countryIDs []uint
+		if err := tx.Model(&models.Country{}).Where("alpha3_code IN ?", seed.Members).Pluck("id", &countryIDs).Error; err != nil {
+			return err
+		}
+		if len(countryIDs) == 0 {
+			continue
+		}
+		members := make([]models.CountryGroupMember, 0, len(countryIDs))
+		for _, countryID := range countryIDs {
+			members = append(members, models.CountryGroupMember{GroupID: group.ID, CountryID: countryID})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addGroupMembers puts countries in a group, bringing back members that
+// were removed before
+func addGroupMembers(tx *gorm.DB, groupID uint, countries []models.Country) error {
+	if len(countries) == 0 {
+		return nil
+	}
+	members := make([]models.CountryGroupMember, 0, len(countries))
+	for _, country := range countries {
+		members = append(members, models.CountryGroupMember{GroupID: groupID, CountryID: country.ID})
+	}
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"deleted_at": nil}),
+	}).Create(&members).Error
+}
+
+func validateGroupRequest(request dto.GroupRequest) error {
+	validationDetails := make(map[string]string)
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		validationDetails["name"] = "is required"
+	} else if len(name) > maxGroupNameLength {
+		validationDetails["name"] = "must be at most 100 characters"
+	} else if _, err := strconv.ParseUint(name, 10, 64); err == nil {
+		// Groups are looked up by ID or name
+		validationDetails["name"] = "must not be a number"
+	}
+	if len(request.Description) > maxGroupDescriptionLength {
+		validationDetails["description"] = "must be at most 512 characters"
+	}
+
+	if len(validationDetails) > 0 {
+		return &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+	return nil
+}
+
+// findGroup resolves a group by ID or, failing that, by name
+func (s countryService) findGroup(identifier string) (*models.CountryGroup, error) {
+	var group *models.CountryGroup
+	var err error
+	if id, parseErr := strconv.ParseUint(identifier, 10, 64); parseErr == nil {
+		group, err = s.groupRepository.GetGroupByID(uint(id))
+	} else {
+		group, err = s.groupRepository.GetGroupByName(strings.TrimSpace(identifier))
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{Message: "Group not found"}
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// resolveMembers looks up the countries named in a group request. Unknown
+// countries are reported together under field.
+func (s countryService) resolveMembers(field string, identifiers []string) ([]models.Country, error) {
+	var countries []models.Country
+	var unknown []string
+	seen := make(map[uint]bool)
+	for _, identifier := range identifiers {
+		country, err := s.findCountry(strings.TrimSpace(identifier), "id", "name")
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				unknown = append(unknown, identifier)
+				continue
+			}
+			return nil, err
+		}
+		if seen[country.ID] {
+			continue
+		}
+		seen[country.ID] = true
+		countries = append(countries, *country)
+	}
+
+	if len(unknown) > 0 {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{field: "unknown countries: " + strings.Join(unknown, ", ")},
+		}
+	}
+	return countries, nil
+}
+
+func (s countryService) checkGroupNameAvailable(name string, groupID uint) error {
+	existing, err := s.groupRepository.GetGroupByName(strings.TrimSpace(name))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if existing.ID == groupID {
+		return nil
+	}
+	return &ConflictError{
+		Message: "Group already exists",
+		Details: map[string]string{"name": "is already used by another group"},
+	}
+}
+
+func toGroupResponse(group models.CountryGroup, memberCount int64) dto.GroupResponse {
+	return dto.GroupResponse{
+		ID:          group.ID,
+		Name:        group.Name,
+		Description: group.Description,
+		Source:      group.Source,
+		MemberCount: memberCount,
+		CreatedAt:   group.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   group.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func (s countryService) GetGroups() ([]dto.GroupResponse, error) {
+	groups, err := s.groupRepository.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	counts, err := s.groupRepository.CountMembers(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.GroupResponse, 0, len(groups))
+	for _, group := range groups {
+		res = append(res, toGroupResponse(group, counts[group.ID]))
+	}
+	return res, nil
+}
+
+func (s countryService) GetGroup(id string) (*dto.GroupDetailResponse, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	countries, err := s.countryRepository.GetAllCountriesWithFilters("", "", "", group.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &dto.GroupDetailResponse{
+		GroupResponse: toGroupResponse(*group, int64(len(*countries))),
+		Countries:     make([]dto.FilterCountriesResponse, 0, len(*countries)),
+	}
+	for _, country := range *countries {
+		res.Countries = append(res.Countries, toFilterCountriesResponse(country))
+	}
+	return res, nil
+}
+
+// CreateGroup creates a group with its initial members. The name of a
+// deleted group can be taken again; the old group is reused without its
+// members.
+func (s countryService) CreateGroup(ctx context.Context, request dto.GroupRequest) (*dto.GroupDetailResponse, error) {
+	if err := validateGroupRequest(request); err != nil {
+		return nil, err
+	}
+	if err := s.checkGroupNameAvailable(request.Name, 0); err != nil {
+		return nil, err
+	}
+	members, err := s.resolveMembers("members", request.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(request.Name)
+	var group models.CountryGroup
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		findErr := tx.Unscoped().Where("LOWER(name) = ?", strings.ToLower(name)).First(&group).Error
+		if findErr != nil && !errors.Is(findErr, gorm.ErrRecordNotFound) {
+			return findErr
+		}
+		if findErr == nil {
+			if err := tx.Unscoped().Where("group_id = ?", group.ID).Delete(&models.CountryGroupMember{}).Error; err != nil {
+				return err
+			}
+		}
+
+		group.Name = name
+		group.Description = request.Description
+		group.Source = models.GroupSourceManual
+		group.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Save(&group).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, group.ID, members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(strconv.FormatUint(uint64(group.ID), 10))
+}
+
+// UpdateGroup renames and redescribes a group, and replaces its members
+// when the request lists them
+func (s countryService) UpdateGroup(ctx context.Context, id string, request dto.GroupRequest) (*dto.GroupDetailResponse, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGroupRequest(request); err != nil {
+		return nil, err
+	}
+	if err := s.checkGroupNameAvailable(request.Name, group.ID); err != nil {
+		return nil, err
+	}
+	var members []models.Country
+	if request.Members != nil {
+		members, err = s.resolveMembers("members", request.Members)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(group).Updates(map[string]interface{}{
+			"name":        strings.TrimSpace(request.Name),
+			"description": request.Description,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if request.Members == nil {
+			return nil
+		}
+
+		remove := tx.Where("group_id = ?", group.ID)
+		if len(members) > 0 {
+			keep := make([]uint, 0, len(members))
+			for _, member := range members {
+				keep = append(keep, member.ID)
+			}
+			remove = remove.Where("country_id NOT IN ?", keep)
+		}
+		if err := remove.Delete(&models.CountryGroupMember{}).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, group.ID, members)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(strconv.FormatUint(uint64(group.ID), 10))
+}
+
+func (s countryService) DeleteGroup(ctx context.Context, id string) error {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Delete(group).Error; err != nil {
+		return err
+	}
+	return s.datasetRepository.BumpVersion()
+}
+
+func (s countryService) GetGroupCountries(id string, sort string, shape dto.ShapeOptions) ([]dto.ShapedCountry, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetAllCountries("", "", sort, strconv.FormatUint(uint64(group.ID), 10), nil, shape)
+}
+
+func (s countryService) AddGroupMembers(ctx context.Context, id string, countries []string) (*dto.GroupDetailResponse, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.resolveMembers("countries", countries)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addGroupMembers(s.db.WithContext(ctx), group.ID, members); err != nil {
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	return s.GetGroup(strconv.FormatUint(uint64(group.ID), 10))
+}
+
+func (s countryService) RemoveGroupMember(ctx context.Context, id string, name string) error {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return err
+	}
+	country, err := s.findCountry(name, "id")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.countryNotFound(name)
+		}
+		return err
+	}
+
+	res := s.db.WithContext(ctx).Where("group_id = ? AND country_id = ?", group.ID, country.ID).Delete(&models.CountryGroupMember{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &NotFoundError{Message: "Country is not a member of the group"}
+	}
+	return s.datasetRepository.BumpVersion()
+}
+
+// GetGroupStats aggregates a group the same way as a region. An empty group
+// has a zero country count and null medians.
+func (s countryService) GetGroupStats(id string) (*dto.GroupStatsResponse, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates, err := s.countryRepository.GetGroupStats(group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &dto.GroupStatsResponse{
+		ID:    group.ID,
+		Group: group.Name,
+	}
+	if len(aggregates) > 0 {
+		res.AggregateStats = toAggregateStats(aggregates[0])
+	}
+	return res, nil
+}
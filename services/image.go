@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"task_2/dto"
+	"task_2/utils"
+	"time"
+)
+
+// summaryImageDir holds the rendered summary images, one file per set of
+// options and dataset version. A refresh empties it.
+const summaryImageDir = "cache/summary"
+
+// maxSummaryImages caps the cached images of the current dataset version;
+// the least recently served go first
+const maxSummaryImages = 200
+
+const (
+	defaultSummaryTop = 5
+	maxSummaryTop     = 50
+	minSummaryWidth   = 400
+	minSummaryHeight  = 300
+	maxSummarySize    = 2000
+	// minScatterWidth leaves room for the bar chart beside the scatter panel
+	minScatterWidth = 700
+)
+
+// summaryMetrics maps the summary image metrics to their ranking metric
+var summaryMetrics = map[string]string{
+	utils.MetricGDP:        "estimated_gdp",
+	utils.MetricPopulation: "population",
+}
+
+// GetSummaryImage returns the path of the summary image for opts, rendering
+// it first unless an image with the same options and data was cached.
+func (s countryService) GetSummaryImage(opts dto.SummaryImageOptions) (string, error) {
+	opts.Metric = strings.ToLower(strings.TrimSpace(opts.Metric))
+	opts.Region = strings.TrimSpace(opts.Region)
+	opts.Theme = strings.ToLower(strings.TrimSpace(opts.Theme))
+	if opts.Top == 0 {
+		opts.Top = defaultSummaryTop
+	}
+	if opts.Metric == "" {
+		opts.Metric = utils.MetricGDP
+	}
+	if opts.Width == 0 {
+		opts.Width = utils.DefaultSummaryWidth
+	}
+	if opts.Height == 0 {
+		opts.Height = utils.DefaultSummaryHeight
+	}
+	if opts.Theme == "" {
+		opts.Theme = utils.DefaultTheme
+	}
+
+	validationDetails := make(map[string]string)
+	if opts.Top < 1 || opts.Top > maxSummaryTop {
+		validationDetails["top"] = fmt.Sprintf("must be between 1 and %d", maxSummaryTop)
+	}
+	if _, ok := summaryMetrics[opts.Metric]; !ok {
+		validationDetails["metric"] = "must be gdp or population"
+	}
+	if opts.Width < minSummaryWidth || opts.Width > maxSummarySize {
+		validationDetails["width"] = fmt.Sprintf("must be between %d and %d", minSummaryWidth, maxSummarySize)
+	} else if opts.Scatter && opts.Width < minScatterWidth {
+		validationDetails["width"] = fmt.Sprintf("must be at least %d with scatter", minScatterWidth)
+	}
+	if opts.Height < minSummaryHeight || opts.Height > maxSummarySize {
+		validationDetails["height"] = fmt.Sprintf("must be between %d and %d", minSummaryHeight, maxSummarySize)
+	}
+	theme, ok := utils.GetTheme(opts.Theme)
+	if !ok {
+		validationDetails["theme"] = fmt.Sprintf("must be one of %s", strings.Join(utils.ThemeNames(), ", "))
+	}
+	if len(validationDetails) > 0 {
+		return "", &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+
+	totalCount, lastRefreshedAt, err := s.countryRepository.GetStats()
+	if err != nil {
+		return "", err
+	}
+	if lastRefreshedAt == "" {
+		return "", &NotFoundError{Message: "Summary image not found. Please refresh countries first."}
+	}
+	version, err := s.datasetRepository.GetVersion()
+	if err != nil {
+		return "", err
+	}
+
+	// The key covers everything drawn, so a cached file is never stale
+	key := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s|%d|%d|%s|%t|%s|%s|%d",
+		opts.Top, opts.Metric, strings.ToLower(opts.Region), opts.Width, opts.Height,
+		opts.Theme, opts.Scatter, theme.Fingerprint, s.baseCurrency, version)))
+	imagePath := filepath.Join(summaryImageDir, fmt.Sprintf("%d-%s.png", version, hex.EncodeToString(key[:16])))
+	if _, err := os.Stat(imagePath); err == nil {
+		// The modification time orders the images for pruning
+		now := time.Now()
+		os.Chtimes(imagePath, now, now)
+		return imagePath, nil
+	}
+
+	summary := utils.SummaryImage{
+		TotalCountries: int(totalCount),
+		Metric:         opts.Metric,
+		Currency:       s.baseCurrency,
+		Width:          opts.Width,
+		Height:         opts.Height,
+		Scatter:        opts.Scatter,
+	}
+	if opts.Region != "" {
+		aggregates, err := s.countryRepository.GetRegionStats(opts.Region)
+		if err != nil {
+			return "", err
+		}
+		if len(aggregates) == 0 {
+			return "", &NotFoundError{Message: "Region not found"}
+		}
+		summary.Region = aggregates[0].GroupKey
+		summary.TotalCountries = int(aggregates[0].CountryCount)
+	}
+	if summary.LastRefreshed, err = time.Parse(time.RFC3339, lastRefreshedAt); err != nil {
+		return "", err
+	}
+
+	rankings, err := s.countryRepository.GetRankings(summaryMetrics[opts.Metric], false, true, opts.Region, opts.Top)
+	if err != nil {
+		return "", err
+	}
+	ranked := make(map[uint]bool, len(rankings))
+	for _, ranking := range rankings {
+		summary.Entries = append(summary.Entries, utils.SummaryEntry{Name: ranking.Name, Value: ranking.Value})
+		ranked[ranking.CountryID] = true
+	}
+
+	if opts.Scatter {
+		countries, err := s.countryRepository.GetAllCountriesWithFilters(opts.Region, "", "", 0, nil, "id", "population", "estimated_gdp")
+		if err != nil {
+			return "", err
+		}
+		for _, country := range *countries {
+			if country.EstimatedGDP == nil {
+				continue
+			}
+			summary.Points = append(summary.Points, utils.ScatterPoint{
+				Population: float64(country.Population),
+				GDP:        *country.EstimatedGDP,
+				Highlight:  ranked[country.ID],
+			})
+		}
+	}
+
+	image, err := utils.RenderSummaryImage(summary, theme)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(imagePath, image); err != nil {
+		return "", err
+	}
+	if err := pruneSummaryImages(version); err != nil {
+		log.Println("Failed to prune summary images because", err.Error())
+	}
+	return imagePath, nil
+}
+
+// pruneSummaryImages removes the images of older dataset versions, which are
+// never served again, and the least recently served ones beyond
+// maxSummaryImages
+func pruneSummaryImages(version uint64) error {
+	entries, err := os.ReadDir(summaryImageDir)
+	if err != nil {
+		return err
+	}
+
+	prefix := fmt.Sprintf("%d-", version)
+	var current []os.FileInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".png" {
+			continue
+		}
+		if !strings.HasPrefix(name, prefix) {
+			if err := os.Remove(filepath.Join(summaryImageDir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		current = append(current, info)
+	}
+
+	if len(current) <= maxSummaryImages {
+		return nil
+	}
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].ModTime().Before(current[j].ModTime())
+	})
+	for _, info := range current[:len(current)-maxSummaryImages] {
+		if err := os.Remove(filepath.Join(summaryImageDir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path,
+// so concurrent readers never see a partly written file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write image file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write image file: %w", err)
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write image file: %w", err)
+	}
+	return os.Rename(file.Name(), path)
+}
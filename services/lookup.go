@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/utils"
+
+	"gorm.io/gorm"
+)
+
+// findCountry resolves a path identifier to a country. The identifier may be
+// the display name, the slug, an alias, or an ISO alpha-2/alpha-3 code, tried
+// in that order.
+func (s countryService) findCountry(identifier string, columns ...string) (*models.Country, error) {
+	country, err := s.countryRepository.GetCountryByName(identifier, columns...)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return country, err
+	}
+
+	country, err = s.countryRepository.GetCountryBySlug(utils.Slugify(identifier), columns...)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return country, err
+	}
+
+	alias, err := s.aliasRepository.GetAliasByNormalized(utils.NormalizeName(identifier))
+	if err == nil {
+		return s.countryRepository.GetCountryByID(alias.CountryID, columns...)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if isCountryCode(identifier) {
+		return s.countryRepository.GetCountryByCode(identifier, columns...)
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// CanonicalSlug returns the slug a country identifier resolves to. It is
+// empty for countries stored before slugs existed.
+func (s countryService) CanonicalSlug(identifier string) (string, error) {
+	country, err := s.findCountry(identifier, "id", "name", "slug")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", s.countryNotFound(identifier)
+		}
+		return "", err
+	}
+	return country.Slug, nil
+}
+
+func (s countryService) GetCountryByCode(code string, shape dto.ShapeOptions) (*dto.ShapedCountry, error) {
+	if !isCountryCode(code) {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"iso": "must be an ISO 3166-1 alpha-2 or alpha-3 code"},
+		}
+	}
+
+	countryShape, err := s.resolveShape(shape)
+	if err != nil {
+		return nil, err
+	}
+
+	country, err := s.countryRepository.GetCountryByCode(code, countryShape.columns...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{Message: "Country not found"}
+		}
+		return nil, err
+	}
+
+	shaped, err := countryShape.apply(s, []models.Country{*country})
+	if err != nil {
+		return nil, err
+	}
+	return &shaped[0], nil
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 && len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
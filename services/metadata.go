@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// metadataKeyPattern limits keys to what reads well in ?meta.key= filters
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// maxMetadataValueLength matches the meta_value column
+const maxMetadataValueLength = 1024
+
+// encodeMetadataValue validates a JSON metadata value and returns its text
+// form and type
+func encodeMetadataValue(value interface{}) (string, string, string) {
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxMetadataValueLength {
+			return "", "", fmt.Sprintf("must be at most %d bytes", maxMetadataValueLength)
+		}
+		return v, models.MetadataTypeString, ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), models.MetadataTypeNumber, ""
+	case bool:
+		return strconv.FormatBool(v), models.MetadataTypeBoolean, ""
+	}
+	return "", "", "must be a string, number or boolean"
+}
+
+// decodeMetadataValue turns a stored value back into its JSON type
+func decodeMetadataValue(entry models.CountryMetadata) interface{} {
+	switch entry.Type {
+	case models.MetadataTypeNumber:
+		if number, err := strconv.ParseFloat(entry.Value, 64); err == nil {
+			return number
+		}
+	case models.MetadataTypeBoolean:
+		if boolean, err := strconv.ParseBool(entry.Value); err == nil {
+			return boolean
+		}
+	}
+	return entry.Value
+}
+
+// metadataCandidates lists the stored text forms a filter value matches.
+// Numbers and booleans are normalized the way encodeMetadataValue stores
+// them, so ?meta.tier=1.0 finds a stored 1.
+func metadataCandidates(raw string) []string {
+	candidates := []string{raw}
+	if number, err := strconv.ParseFloat(raw, 64); err == nil {
+		candidates = append(candidates, strconv.FormatFloat(number, 'f', -1, 64))
+	}
+	if boolean, err := strconv.ParseBool(raw); err == nil {
+		candidates = append(candidates, strconv.FormatBool(boolean))
+	}
+	return candidates
+}
+
+// metadataFilter validates ?meta.key=value filters. Repeated values for a
+// key match any of them.
+func metadataFilter(meta map[string][]string) (repository.MetadataFilter, error) {
+	if len(meta) == 0 {
+		return nil, nil
+	}
+
+	filter := make(repository.MetadataFilter, len(meta))
+	for key, values := range meta {
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, &ValidationError{
+				Message: "Validation failed",
+				Details: map[string]string{"meta." + key: "key must be 1-64 letters, digits, '_' or '-'"},
+			}
+		}
+		for _, value := range values {
+			filter[key] = append(filter[key], metadataCandidates(value)...)
+		}
+	}
+	return filter, nil
+}
+
+// groupMetadata indexes metadata by country as key-value objects
+func groupMetadata(entries []models.CountryMetadata) map[uint]map[string]interface{} {
+	grouped := make(map[uint]map[string]interface{})
+	for _, entry := range entries {
+		if grouped[entry.CountryID] == nil {
+			grouped[entry.CountryID] = make(map[string]interface{})
+		}
+		grouped[entry.CountryID][entry.Key] = decodeMetadataValue(entry)
+	}
+	return grouped
+}
+
+// metadataObject keeps countries without metadata at {} rather than null
+func metadataObject(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return map[string]interface{}{}
+	}
+	return metadata
+}
+
+func toMetadataEntry(entry models.CountryMetadata) dto.MetadataEntry {
+	return dto.MetadataEntry{
+		Key:       entry.Key,
+		Value:     decodeMetadataValue(entry),
+		Type:      entry.Type,
+		UpdatedAt: entry.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func (s countryService) GetMetadata(name string) (map[string]interface{}, error) {
+	country, err := s.findCountry(name, "id")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+
+	entries, err := s.metadataRepository.GetMetadataForCountries([]uint{country.ID})
+	if err != nil {
+		return nil, err
+	}
+	return metadataObject(groupMetadata(entries)[country.ID]), nil
+}
+
+// SetMetadata creates or replaces one metadata key. created reports a new
+// key. Metadata is part of the country's representation, so its version
+// goes up too.
+func (s countryService) SetMetadata(ctx context.Context, name string, key string, value interface{}) (*dto.MetadataEntry, bool, error) {
+	validationDetails := make(map[string]string)
+	if !metadataKeyPattern.MatchString(key) {
+		validationDetails["key"] = "must be 1-64 letters, digits, '_' or '-'"
+	}
+	text, valueType, detail := encodeMetadataValue(value)
+	if detail != "" {
+		validationDetails["value"] = detail
+	}
+	if len(validationDetails) > 0 {
+		return nil, false, &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+
+	country, err := s.findCountry(name, "id")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, s.countryNotFound(name)
+		}
+		return nil, false, err
+	}
+
+	var entry models.CountryMetadata
+	created := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		findErr := tx.Where("country_id = ? AND meta_key = ?", country.ID, key).First(&entry).Error
+		if errors.Is(findErr, gorm.ErrRecordNotFound) {
+			entry = models.CountryMetadata{CountryID: country.ID, Key: key}
+			created = true
+		} else if findErr != nil {
+			return findErr
+		}
+
+		entry.Value = text
+		entry.Type = valueType
+		if err := tx.Save(&entry).Error; err != nil {
+			return err
+		}
+		return touchCountry(tx, country.ID)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, false, err
+	}
+
+	response := toMetadataEntry(entry)
+	return &response, created, nil
+}
+
+// touchCountry increases a country's version and updated_at after a change
+// to data stored beside it, so ETags and If-Modified-Since see the change
+func touchCountry(tx *gorm.DB, countryID uint) error {
+	return tx.Model(&models.Country{}).Where("id = ?", countryID).UpdateColumns(map[string]interface{}{
+		"version":    gorm.Expr("version + 1"),
+		"updated_at": time.Now(),
+	}).Error
+}
+
+func (s countryService) DeleteMetadata(ctx context.Context, name string, key string) error {
+	country, err := s.findCountry(name, "id")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.countryNotFound(name)
+		}
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("country_id = ? AND meta_key = ?", country.ID, key).Delete(&models.CountryMetadata{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return &NotFoundError{Message: "Metadata key not found"}
+		}
+		return touchCountry(tx, country.ID)
+	})
+	if err != nil {
+		return err
+	}
+	return s.datasetRepository.BumpVersion()
+}
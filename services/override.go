@@ -0,0 +1,446 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// overridableFields are the country fields an override may replace. The name
+// is excluded since refreshes match countries on it; derived fields follow
+// from population and currency.
+var overridableFields = []string{"alpha2_code", "alpha3_code", "capital", "region", "population", "currency_code", "flag_url"}
+
+func isOverridable(field string) bool {
+	for _, f := range overridableFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// countryFieldValue returns the text form of an overridable field
+func countryFieldValue(country *models.Country, field string) *string {
+	var value string
+	switch field {
+	case "alpha2_code":
+		value = country.Alpha2Code
+	case "alpha3_code":
+		value = country.Alpha3Code
+	case "capital":
+		value = country.Capital
+	case "region":
+		value = country.Region
+	case "population":
+		value = strconv.FormatInt(country.Population, 10)
+	case "currency_code":
+		if country.CurrencyCode == nil {
+			return nil
+		}
+		value = *country.CurrencyCode
+	case "flag_url":
+		value = country.FlagURL
+	default:
+		return nil
+	}
+	return &value
+}
+
+// setCountryField sets an overridable field from its text form
+func setCountryField(country *models.Country, field string, value *string) {
+	text := ""
+	if value != nil {
+		text = *value
+	}
+	switch field {
+	case "alpha2_code":
+		country.Alpha2Code = text
+	case "alpha3_code":
+		country.Alpha3Code = text
+	case "capital":
+		country.Capital = text
+	case "region":
+		country.Region = text
+	case "population":
+		population, _ := strconv.ParseInt(text, 10, 64)
+		country.Population = population
+	case "currency_code":
+		if value == nil {
+			country.CurrencyCode = nil
+			return
+		}
+		code := text
+		country.CurrencyCode = &code
+	case "flag_url":
+		country.FlagURL = text
+	}
+}
+
+// affectsPrice reports whether changing field changes the estimated GDP
+func affectsPrice(field string) bool {
+	return field == "population" || field == "currency_code"
+}
+
+// parseOverrideValue validates a JSON override value for field and returns
+// its text form.
+func parseOverrideValue(field string, value interface{}) (*string, string) {
+	if value == nil {
+		if field == "currency_code" {
+			return nil, ""
+		}
+		return nil, "is required"
+	}
+
+	switch field {
+	case "population":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) || number < 0 || number > math.MaxInt64 {
+			return nil, "must be a non-negative integer"
+		}
+		text := strconv.FormatInt(int64(number), 10)
+		return &text, ""
+	case "alpha2_code", "alpha3_code", "currency_code":
+		length := map[string]int{"alpha2_code": 2, "alpha3_code": 3, "currency_code": 3}[field]
+		text, ok := value.(string)
+		if !ok || !isLetterCode(text, length) {
+			return nil, fmt.Sprintf("must be a %d-letter code", length)
+		}
+		text = strings.ToUpper(text)
+		return &text, ""
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return nil, "must be a string"
+		}
+		return &text, ""
+	}
+}
+
+// typedOverrideValue turns the text form back into its JSON type
+func typedOverrideValue(field string, value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	if field == "population" {
+		population, err := strconv.ParseInt(*value, 10, 64)
+		if err == nil {
+			return population
+		}
+	}
+	return *value
+}
+
+// applyOverrides lays overrides over countries read from the database and
+// returns the overridden fields per country. Active overrides are already
+// stored on the row; expired ones are rolled back to the upstream value,
+// and the country repriced where needed, until ExpireOverrides writes it
+// to the row.
+func (s countryService) applyOverrides(countries []models.Country, overrides []models.CountryOverride, now time.Time) (map[uint][]string, error) {
+	byCountry := make(map[uint][]models.CountryOverride)
+	for _, override := range overrides {
+		byCountry[override.CountryID] = append(byCountry[override.CountryID], override)
+	}
+
+	overridden := make(map[uint][]string)
+	for i := range countries {
+		reprice := false
+		for _, override := range byCountry[countries[i].ID] {
+			if override.Active(now) {
+				setCountryField(&countries[i], override.Field, override.Value)
+				overridden[countries[i].ID] = append(overridden[countries[i].ID], override.Field)
+			} else if override.RestoredAt == nil {
+				setCountryField(&countries[i], override.Field, override.UpstreamValue)
+				reprice = reprice || affectsPrice(override.Field)
+			}
+		}
+		if reprice {
+			if err := s.priceCountry(&countries[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return overridden, nil
+}
+
+// refreshOverrides applies the overrides of one country to a freshly
+// fetched record inside the refresh transaction. The upstream value is
+// kept on each override so it can be restored, and expired overrides are
+// deleted. It returns the columns that must be written even when zero.
+func refreshOverrides(tx *gorm.DB, record *models.Country, overrides []models.CountryOverride, now time.Time) ([]string, error) {
+	var columns []string
+	for _, override := range overrides {
+		upstream := countryFieldValue(record, override.Field)
+		columns = append(columns, override.Field)
+
+		if !override.Active(now) {
+			if err := tx.Delete(&override).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := tx.Model(&override).Update("upstream_value", upstream).Error; err != nil {
+			return nil, err
+		}
+		setCountryField(record, override.Field, override.Value)
+	}
+	return columns, nil
+}
+
+// writeCountryFields stores the given fields of country, repricing it first
+// when population or currency are among them.
+func (s countryService) writeCountryFields(tx *gorm.DB, country *models.Country, fields []string) error {
+	columns := append([]string{}, fields...)
+	for _, field := range fields {
+		if affectsPrice(field) {
+			if err := s.priceCountry(country); err != nil {
+				return err
+			}
+			columns = append(columns, "exchange_rate", "estimated_gdp")
+			break
+		}
+	}
+	if err := tx.Model(&models.Country{}).Where("id = ?", country.ID).Select(columns).Updates(country).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Country{}).Where("id = ?", country.ID).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+func toOverrideResponse(override models.CountryOverride, countryName string, now time.Time) dto.CountryOverrideResponse {
+	response := dto.CountryOverrideResponse{
+		Country:       countryName,
+		Field:         override.Field,
+		Value:         typedOverrideValue(override.Field, override.Value),
+		UpstreamValue: typedOverrideValue(override.Field, override.UpstreamValue),
+		Author:        override.Author,
+		Reason:        override.Reason,
+		Active:        override.Active(now),
+		CreatedAt:     override.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     override.UpdatedAt.Format(time.RFC3339),
+	}
+	if override.ExpiresAt != nil {
+		expiresAt := override.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &expiresAt
+	}
+	return response
+}
+
+// GetOverrides lists the overrides of every country, expired ones only when
+// includeExpired is set.
+func (s countryService) GetOverrides(includeExpired bool) ([]dto.CountryOverrideResponse, error) {
+	overrides, err := s.overrideRepository.GetAllOverrides()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(overrides))
+	for _, override := range overrides {
+		ids = append(ids, override.CountryID)
+	}
+	countries, err := s.countryRepository.FindCountries(repository.CountryLookup{IDs: ids}, "id", "name")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(countries))
+	for _, country := range countries {
+		names[country.ID] = country.Name
+	}
+
+	now := time.Now()
+	res := make([]dto.CountryOverrideResponse, 0, len(overrides))
+	for _, override := range overrides {
+		if !includeExpired && !override.Active(now) {
+			continue
+		}
+		res = append(res, toOverrideResponse(override, names[override.CountryID], now))
+	}
+	return res, nil
+}
+
+func (s countryService) GetCountryOverrides(name string) ([]dto.CountryOverrideResponse, error) {
+	country, err := s.findCountry(name, "id", "name")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+
+	overrides, err := s.overrideRepository.GetOverridesForCountries([]uint{country.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := make([]dto.CountryOverrideResponse, 0, len(overrides))
+	for _, override := range overrides {
+		res = append(res, toOverrideResponse(override, country.Name, now))
+	}
+	return res, nil
+}
+
+// SetOverride creates or replaces the override of one field and applies it
+// to the stored country straight away. created reports a new override.
+func (s countryService) SetOverride(ctx context.Context, name string, field string, request dto.OverrideRequest) (*dto.CountryOverrideResponse, bool, error) {
+	validationDetails := make(map[string]string)
+	if !isOverridable(field) {
+		validationDetails["field"] = fmt.Sprintf("must be one of %s", strings.Join(overridableFields, ", "))
+	}
+	value, detail := parseOverrideValue(field, request.Value)
+	if detail != "" && validationDetails["field"] == "" {
+		validationDetails["value"] = detail
+	}
+	if strings.TrimSpace(request.Author) == "" {
+		validationDetails["author"] = "is required"
+	}
+	now := time.Now()
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(now) {
+		validationDetails["expires_at"] = "must be in the future"
+	}
+	if len(validationDetails) > 0 {
+		return nil, false, &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+
+	country, err := s.findCountry(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, s.countryNotFound(name)
+		}
+		return nil, false, err
+	}
+
+	var override models.CountryOverride
+	created := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		findErr := tx.Where("country_id = ? AND field = ?", country.ID, field).First(&override).Error
+		if errors.Is(findErr, gorm.ErrRecordNotFound) {
+			// The row holds the upstream value until the first override
+			override = models.CountryOverride{
+				CountryID:     country.ID,
+				Field:         field,
+				UpstreamValue: countryFieldValue(country, field),
+			}
+			created = true
+		} else if findErr != nil {
+			return findErr
+		}
+
+		override.Value = value
+		override.Author = strings.TrimSpace(request.Author)
+		override.Reason = request.Reason
+		override.ExpiresAt = request.ExpiresAt
+		override.RestoredAt = nil
+		if err := tx.Save(&override).Error; err != nil {
+			return err
+		}
+
+		setCountryField(country, field, value)
+		return s.writeCountryFields(tx, country, []string{field})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, false, err
+	}
+
+	response := toOverrideResponse(override, country.Name, now)
+	return &response, created, nil
+}
+
+// ExpireOverrides writes the upstream value back to the countries whose
+// overrides have expired, repricing them where needed, so filters, sorting
+// and aggregates in SQL agree with what reads show. The overrides are kept,
+// marked restored, until the next refresh deletes them.
+func (s countryService) ExpireOverrides(ctx context.Context) error {
+	now := time.Now()
+	overrides, err := s.overrideRepository.GetExpiredOverrides(now)
+	if err != nil || len(overrides) == 0 {
+		return err
+	}
+
+	byCountry := make(map[uint][]models.CountryOverride)
+	for _, override := range overrides {
+		byCountry[override.CountryID] = append(byCountry[override.CountryID], override)
+	}
+
+	for countryID, expired := range byCountry {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var country models.Country
+			if err := tx.First(&country, countryID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+
+			var fields []string
+			for _, override := range expired {
+				// Another instance may have restored it meanwhile
+				result := tx.Model(&models.CountryOverride{}).
+					Where("id = ? AND restored_at IS NULL", override.ID).
+					Update("restored_at", now)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					continue
+				}
+				setCountryField(&country, override.Field, override.UpstreamValue)
+				fields = append(fields, override.Field)
+			}
+			if len(fields) == 0 {
+				return nil
+			}
+			return s.writeCountryFields(tx, &country, fields)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.datasetRepository.BumpVersion()
+}
+
+// DeleteOverride removes an override and restores the upstream value
+func (s countryService) DeleteOverride(ctx context.Context, name string, field string) error {
+	country, err := s.findCountry(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.countryNotFound(name)
+		}
+		return err
+	}
+
+	override, err := s.overrideRepository.GetOverride(country.ID, field)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &NotFoundError{Message: "Override not found"}
+		}
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(override).Error; err != nil {
+			return err
+		}
+		setCountryField(country, field, override.UpstreamValue)
+		return s.writeCountryFields(tx, country, []string{field})
+	})
+	if err != nil {
+		return err
+	}
+	return s.datasetRepository.BumpVersion()
+}
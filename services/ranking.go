@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRankingLimit = 10
+	maxRankingLimit     = 250
+)
+
+func (s countryService) GetRankings(metric string, scope string, order string, region string, limit int) ([]dto.RankingEntry, error) {
+	validationDetails := make(map[string]string)
+	if _, ok := repository.RankMetrics[metric]; !ok {
+		validationDetails["metric"] = fmt.Sprintf("must be one of %s", strings.Join(repository.RankMetricNames, ", "))
+	}
+	if scope == "" {
+		scope = "global"
+	}
+	if scope != "global" && scope != "region" {
+		validationDetails["scope"] = "must be global or region"
+	}
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		validationDetails["order"] = "must be asc or desc"
+	}
+	if len(validationDetails) > 0 {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+
+	if limit <= 0 {
+		limit = defaultRankingLimit
+	}
+	if limit > maxRankingLimit {
+		limit = maxRankingLimit
+	}
+
+	rankings, err := s.countryRepository.GetRankings(metric, scope == "region", order == "desc", region, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.RankingEntry, 0, len(rankings))
+	for _, ranking := range rankings {
+		res = append(res, dto.RankingEntry{
+			Rank:       ranking.Rank,
+			DenseRank:  ranking.DenseRank,
+			Percentile: roundPercentile(ranking.Percentile),
+			ID:         ranking.CountryID,
+			Name:       ranking.Name,
+			Region:     ranking.Region,
+			Value:      ranking.Value,
+			Total:      ranking.Total,
+		})
+	}
+	return res, nil
+}
+
+// GetCountryRankings returns a country's position on every rankable metric,
+// globally and within its region.
+func (s countryService) GetCountryRankings(name string) (*dto.CountryRankingsResponse, error) {
+	country, err := s.findCountry(name, "id", "name", "region")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+
+	rankings, err := s.countryRankings([]models.Country{*country})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.CountryRankingsResponse{
+		ID:       country.ID,
+		Name:     country.Name,
+		Region:   country.Region,
+		Rankings: rankings[country.ID],
+	}, nil
+}
+
+// countryRankings looks up the global and regional rankings of each country
+// on every rankable metric. Metrics a country has no value for are nil.
+func (s countryService) countryRankings(countries []models.Country) (map[uint]map[string]*dto.CountryMetricRanking, error) {
+	ids := make([]uint, 0, len(countries))
+	res := make(map[uint]map[string]*dto.CountryMetricRanking, len(countries))
+	for _, country := range countries {
+		ids = append(ids, country.ID)
+		res[country.ID] = make(map[string]*dto.CountryMetricRanking, len(repository.RankMetricNames))
+		for _, metric := range repository.RankMetricNames {
+			res[country.ID][metric] = nil
+		}
+	}
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	for _, metric := range repository.RankMetricNames {
+		for _, byRegion := range []bool{false, true} {
+			rankings, err := s.countryRepository.GetCountryRankings(metric, byRegion, ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, ranking := range rankings {
+				entry := res[ranking.CountryID][metric]
+				if entry == nil {
+					entry = &dto.CountryMetricRanking{Value: ranking.Value}
+					res[ranking.CountryID][metric] = entry
+				}
+				scoped := &dto.ScopedRank{
+					Rank:       ranking.Rank,
+					DenseRank:  ranking.DenseRank,
+					Percentile: roundPercentile(ranking.Percentile),
+					Total:      ranking.Total,
+				}
+				if byRegion {
+					entry.Region = scoped
+				} else {
+					entry.Global = scoped
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+func roundPercentile(p float64) float64 {
+	return math.Round(p*100) / 100
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"task_2/dto"
+	"task_2/repository"
+)
+
+func (s countryService) GetRegions() ([]dto.RegionStatsResponse, error) {
+	aggregates, err := s.countryRepository.GetRegionStats("")
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dto.RegionStatsResponse, 0, len(aggregates))
+	for _, aggregate := range aggregates {
+		res = append(res, dto.RegionStatsResponse{
+			Region:         aggregate.GroupKey,
+			AggregateStats: toAggregateStats(aggregate),
+		})
+	}
+	return res, nil
+}
+
+func (s countryService) GetRegionStats(region string) (*dto.RegionStatsResponse, error) {
+	aggregates, err := s.countryRepository.GetRegionStats(region)
+	if err != nil {
+		return nil, err
+	}
+	if len(aggregates) == 0 {
+		return nil, &NotFoundError{Message: "Region not found"}
+	}
+
+	return &dto.RegionStatsResponse{
+		Region:         aggregates[0].GroupKey,
+		AggregateStats: toAggregateStats(aggregates[0]),
+	}, nil
+}
+
+func toAggregateStats(aggregate repository.CountryAggregate) dto.AggregateStats {
+	return dto.AggregateStats{
+		CountryCount:        aggregate.CountryCount,
+		TotalPopulation:     aggregate.TotalPopulation,
+		MedianPopulation:    aggregate.MedianPopulation,
+		TotalEstimatedGDP:   aggregate.TotalEstimatedGDP,
+		MeanEstimatedGDP:    aggregate.MeanEstimatedGDP,
+		MedianEstimatedGDP:  aggregate.MedianEstimatedGDP,
+		GDPPerCapita:        aggregate.GDPPerCapita,
+		MissingExchangeRate: aggregate.MissingExchangeRate,
+		MissingCurrency:     aggregate.MissingCurrency,
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/utils"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	suggestionLimit    = 5
+)
+
+type NotFoundError struct {
+	Message     string
+	Suggestions []string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+type rankedCountry struct {
+	country      models.Country
+	score        float64
+	matchType    string
+	matchedAlias string
+}
+
+func (s countryService) SearchCountries(query string, limit int) ([]dto.CountrySearchResult, error) {
+	normalizedQuery := utils.NormalizeName(query)
+	if normalizedQuery == "" {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: map[string]string{"q": "is required"},
+		}
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	ranked, err := s.rankCountries(normalizedQuery)
+	if err != nil {
+		return nil, err
+	}
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	res := make([]dto.CountrySearchResult, 0, len(ranked))
+	for _, r := range ranked {
+		res = append(res, dto.CountrySearchResult{
+			FilterCountriesResponse: toFilterCountriesResponse(r.country),
+			Score:                   math.Round(r.score*1000) / 1000,
+			MatchType:               r.matchType,
+			MatchedAlias:            r.matchedAlias,
+		})
+	}
+	return res, nil
+}
+
+// searchCandidates are the stored country names and aliases a query is
+// ranked against
+type searchCandidates struct {
+	countries        []models.Country
+	aliasesByCountry map[uint][]models.CountryAlias
+}
+
+// loadSearchCandidates reads every country and alias once so several
+// queries can be ranked against them
+func (s countryService) loadSearchCandidates() (*searchCandidates, error) {
+	countries, err := s.countryRepository.GetAllCountries()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := s.aliasRepository.GetAllAliases()
+	if err != nil {
+		return nil, err
+	}
+	aliasesByCountry := make(map[uint][]models.CountryAlias)
+	for _, alias := range aliases {
+		aliasesByCountry[alias.CountryID] = append(aliasesByCountry[alias.CountryID], alias)
+	}
+	return &searchCandidates{countries: *countries, aliasesByCountry: aliasesByCountry}, nil
+}
+
+// rankCountries scores every stored country name and alias against an
+// already normalized query and returns the matches best first. A country
+// is ranked by its best matching name.
+func (s countryService) rankCountries(normalizedQuery string) ([]rankedCountry, error) {
+	candidates, err := s.loadSearchCandidates()
+	if err != nil {
+		return nil, err
+	}
+	return candidates.rank(normalizedQuery), nil
+}
+
+func (c *searchCandidates) rank(normalizedQuery string) []rankedCountry {
+	var ranked []rankedCountry
+	for _, country := range c.countries {
+		best := rankedCountry{country: country}
+		score, matchType, ok := utils.RankName(normalizedQuery, utils.NormalizeName(country.Name))
+		if ok {
+			best.score, best.matchType = score, matchType
+		}
+		for _, alias := range c.aliasesByCountry[country.ID] {
+			score, matchType, ok := utils.RankName(normalizedQuery, alias.NormalizedAlias)
+			if ok && score > best.score {
+				best.score, best.matchType, best.matchedAlias = score, matchType, alias.Alias
+			}
+		}
+		if best.score == 0 {
+			continue
+		}
+		ranked = append(ranked, best)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].country.Name < ranked[j].country.Name
+	})
+	return ranked
+}
+
+// suggestions returns the names closest to name, best first
+func (c *searchCandidates) suggestions(name string) []string {
+	var names []string
+	for i, r := range c.rank(utils.NormalizeName(name)) {
+		if i >= suggestionLimit {
+			break
+		}
+		names = append(names, r.country.Name)
+	}
+	return names
+}
+
+// countryNotFound builds the not found error for a by-name lookup, with the
+// closest matching names as suggestions.
+func (s countryService) countryNotFound(name string) error {
+	notFound := &NotFoundError{Message: "Country not found"}
+
+	candidates, err := s.loadSearchCandidates()
+	if err != nil {
+		return notFound
+	}
+	notFound.Suggestions = candidates.suggestions(name)
+	return notFound
+}
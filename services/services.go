@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"os"
 	"strings"
 	"task_2/clients"
 	"task_2/dto"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ValidationError struct {
@@ -23,45 +26,128 @@ func (e *ValidationError) Error() string {
 }
 
 type CountryService interface {
-	RefreshCountries() (dto.RefreshCountriesResponse, error)
+	RefreshCountries(ctx context.Context) (dto.RefreshCountriesResponse, error)
 	GetStats() (*dto.GetCountryStatsResponse, error)
-	GetCountryByName(name string) (*dto.GetCountryByNameResponse, error)
-	GetAllCountries(region string, currency string, sort string) ([]dto.FilterCountriesResponse, error)
-	DeleteCountryByName(name string) error
+	GetCountryByName(name string, shape dto.ShapeOptions) (*dto.ShapedCountry, error)
+	GetAllCountries(region string, currency string, sort string, group string, meta map[string][]string, shape dto.ShapeOptions) ([]dto.ShapedCountry, error)
+	SearchCountries(query string, limit int) ([]dto.CountrySearchResult, error)
+	CanonicalSlug(identifier string) (string, error)
+	GetCountryByCode(code string, shape dto.ShapeOptions) (*dto.ShapedCountry, error)
+	CreateCountry(ctx context.Context, request dto.CountryRequest) (*dto.FilterCountriesResponse, error)
+	GetCountryVersion(name string) (*dto.CountryVersion, error)
+	ReplaceCountry(ctx context.Context, name string, precondition Precondition, request dto.CountryRequest) (*dto.FilterCountriesResponse, error)
+	PatchCountry(ctx context.Context, name string, precondition Precondition, patch map[string]interface{}) (*dto.FilterCountriesResponse, error)
+	DeleteCountryByName(ctx context.Context, name string, precondition Precondition) error
+	PreviewBulkDelete(filter dto.BulkDeleteFilter) (*dto.BulkDeletePreview, error)
+	ConfirmBulkDelete(ctx context.Context, filter dto.BulkDeleteFilter, token string) (*dto.DeletionResponse, error)
+	GetDeletions() ([]dto.DeletionResponse, error)
+	RestoreDeletion(ctx context.Context, deletionID string) (*dto.RestoreResponse, error)
+	GetAliases(name string) ([]dto.CountryAliasResponse, error)
+	AddAlias(ctx context.Context, name string, alias string) (*dto.CountryAliasResponse, error)
+	DeleteAlias(ctx context.Context, name string, alias string) error
+	GetOverrides(includeExpired bool) ([]dto.CountryOverrideResponse, error)
+	GetCountryOverrides(name string) ([]dto.CountryOverrideResponse, error)
+	SetOverride(ctx context.Context, name string, field string, request dto.OverrideRequest) (*dto.CountryOverrideResponse, bool, error)
+	DeleteOverride(ctx context.Context, name string, field string) error
+	ExpireOverrides(ctx context.Context) error
+	GetMetadata(name string) (map[string]interface{}, error)
+	SetMetadata(ctx context.Context, name string, key string, value interface{}) (*dto.MetadataEntry, bool, error)
+	DeleteMetadata(ctx context.Context, name string, key string) error
+	GetRegions() ([]dto.RegionStatsResponse, error)
+	GetRegionStats(region string) (*dto.RegionStatsResponse, error)
+	GetGroups() ([]dto.GroupResponse, error)
+	GetGroup(id string) (*dto.GroupDetailResponse, error)
+	CreateGroup(ctx context.Context, request dto.GroupRequest) (*dto.GroupDetailResponse, error)
+	UpdateGroup(ctx context.Context, id string, request dto.GroupRequest) (*dto.GroupDetailResponse, error)
+	DeleteGroup(ctx context.Context, id string) error
+	GetGroupCountries(id string, sort string, shape dto.ShapeOptions) ([]dto.ShapedCountry, error)
+	AddGroupMembers(ctx context.Context, id string, countries []string) (*dto.GroupDetailResponse, error)
+	RemoveGroupMember(ctx context.Context, id string, name string) error
+	GetGroupStats(id string) (*dto.GroupStatsResponse, error)
+	GetCurrencies(minCountries int) ([]dto.CurrencyResponse, error)
+	GetCurrencyByCode(code string) (*dto.CurrencyDetailResponse, error)
+	GetCurrencyCountries(code string, sort string, shape dto.ShapeOptions) ([]dto.ShapedCountry, error)
+	Convert(from string, to string, amount float64, asOf *time.Time) (*dto.ConvertResponse, error)
+	CompareCountries(names []string) (*dto.CompareResponse, error)
+	CompareCountriesImage(names []string) ([]byte, error)
+	GetSummaryImage(opts dto.SummaryImageOptions) (string, error)
+	GetRankings(metric string, scope string, order string, region string, limit int) ([]dto.RankingEntry, error)
+	GetCountryRankings(name string) (*dto.CountryRankingsResponse, error)
+	BatchLookup(names []string, codes []string, shape dto.ShapeOptions) (*dto.BatchLookupResponse, error)
+	ExportCountries(region string, currency string, shape dto.ShapeOptions, fn func(dto.ShapedCountry) error) error
+	GetDatasetState() (*dto.DatasetState, error)
+	GetAuditEvents(country string, actor string, since *time.Time, limit int) ([]dto.AuditEventResponse, error)
 }
 
 type countryService struct {
-	countryRepository repository.CountryRepository
-	db                *gorm.DB
+	countryRepository  repository.CountryRepository
+	aliasRepository    repository.AliasRepository
+	currencyRepository repository.CurrencyRepository
+	datasetRepository  repository.DatasetRepository
+	overrideRepository repository.OverrideRepository
+	deletionRepository repository.DeletionRepository
+	metadataRepository repository.MetadataRepository
+	groupRepository    repository.GroupRepository
+	auditRepository    repository.AuditRepository
+	db                 *gorm.DB
+	// currency exchange rates and GDP estimates are quoted in
+	baseCurrency string
+	// how long deleted countries can be restored
+	deletionRetention time.Duration
+	// key bulk delete tokens are signed with, empty when bulk delete is
+	// disabled
+	bulkDeleteSecret []byte
 }
 
-func NewCountryService(countryRepo repository.CountryRepository, db *gorm.DB) CountryService {
+func NewCountryService(countryRepo repository.CountryRepository, aliasRepo repository.AliasRepository, currencyRepo repository.CurrencyRepository, datasetRepo repository.DatasetRepository, overrideRepo repository.OverrideRepository, deletionRepo repository.DeletionRepository, metadataRepo repository.MetadataRepository, groupRepo repository.GroupRepository, auditRepo repository.AuditRepository, db *gorm.DB, baseCurrency string, deletionRetention time.Duration, bulkDeleteSecret string) CountryService {
 	return &countryService{
-		countryRepository: countryRepo,
-		db:                db,
+		countryRepository:  countryRepo,
+		aliasRepository:    aliasRepo,
+		currencyRepository: currencyRepo,
+		datasetRepository:  datasetRepo,
+		overrideRepository: overrideRepo,
+		deletionRepository: deletionRepo,
+		metadataRepository: metadataRepo,
+		groupRepository:    groupRepo,
+		auditRepository:    auditRepo,
+		db:                 db,
+		baseCurrency:       baseCurrency,
+		deletionRetention:  deletionRetention,
+		bulkDeleteSecret:   []byte(bulkDeleteSecret),
 	}
 }
 
 // Call the client to get the list of countries
-func (s countryService) RefreshCountries() (dto.RefreshCountriesResponse, error) {
+func (s countryService) RefreshCountries(ctx context.Context) (dto.RefreshCountriesResponse, error) {
 	countries, err := clients.GetCountries()
 	if err != nil {
 		return dto.RefreshCountriesResponse{}, errors.New("failed to fetch country data from external API")
 	}
 
-	rates, err := clients.GetExchangeRates()
+	rates, err := clients.GetExchangeRates(s.baseCurrency)
 	if err != nil {
 		return dto.RefreshCountriesResponse{}, errors.New("failed to fetch exchange rates from external API")
 	}
 
-	err = s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		now := time.Now()
 
+		var overrides []models.CountryOverride
+		if err := tx.Find(&overrides).Error; err != nil {
+			return err
+		}
+		overridesByCountry := make(map[uint][]models.CountryOverride)
+		for _, override := range overrides {
+			overridesByCountry[override.CountryID] = append(overridesByCountry[override.CountryID], override)
+		}
+
 		for _, country := range *countries {
 			normalizedName := strings.ToLower(country.Name)
 
 			var ct models.Country
-			findErr := tx.Session(&gorm.Session{Logger: tx.Logger.LogMode(4)}).Where("LOWER(name) = ?", normalizedName).First(&ct).Error
+			// Lock the row so a concurrent edit can't slip between the read
+			// and the version bump below
+			findErr := tx.Session(&gorm.Session{Logger: tx.Logger.LogMode(4)}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("LOWER(name) = ?", normalizedName).First(&ct).Error
 
 			// Prepare values to persist
 			var currencyPtr *string
@@ -91,6 +177,9 @@ func (s countryService) RefreshCountries() (dto.RefreshCountriesResponse, error)
 			// Build record to insert/update
 			record := models.Country{
 				Name:            country.Name,
+				Alpha2Code:      strings.ToUpper(country.Alpha2Code),
+				Alpha3Code:      strings.ToUpper(country.Alpha3Code),
+				Slug:            utils.Slugify(country.Name),
 				Capital:         country.Capital,
 				Region:          country.Region,
 				Population:      country.Population,
@@ -103,16 +192,7 @@ func (s countryService) RefreshCountries() (dto.RefreshCountriesResponse, error)
 
 			if findErr != nil {
 				if errors.Is(findErr, gorm.ErrRecordNotFound) {
-					validationDetails := make(map[string]string)
-					if strings.TrimSpace(country.Name) == "" {
-						validationDetails["name"] = "is required"
-					}
-					if country.Population < 0 {
-						validationDetails["population"] = "must be non-negative"
-					}
-					if len(country.Currencies) > 0 && (currencyPtr == nil || strings.TrimSpace(*currencyPtr) == "") {
-						validationDetails["currency_code"] = "is required"
-					}
+					validationDetails := validateCountry(country.Name, country.Population, len(country.Currencies) > 0, currencyPtr)
 
 					if len(validationDetails) > 0 {
 						return &ValidationError{
@@ -121,35 +201,68 @@ func (s countryService) RefreshCountries() (dto.RefreshCountriesResponse, error)
 						}
 					}
 
+					record.Version = 1
 					if err := tx.Create(&record).Error; err != nil {
 						return err
 					}
+					if err := seedAliases(tx, record.ID, record.Name, country.AltSpellings); err != nil {
+						return err
+					}
 					continue
 				}
 				return findErr
 			}
 
+			record.Version = ct.Version + 1
+
+			// Hand-maintained overrides win over upstream values
+			overridden, err := refreshOverrides(tx, &record, overridesByCountry[ct.ID], now)
+			if err != nil {
+				return err
+			}
+			for _, field := range overridden {
+				if affectsPrice(field) {
+					priceFromRates(&record, rates.Rates)
+					overridden = append(overridden, "exchange_rate", "estimated_gdp")
+					break
+				}
+			}
+
 			if err := tx.Model(&ct).Updates(record).Error; err != nil {
 				return err
 			}
+			if len(overridden) > 0 {
+				// Updates skips zero values, which an override may set
+				if err := tx.Model(&ct).Select(overridden).Updates(record).Error; err != nil {
+					return err
+				}
+			}
+			if err := seedAliases(tx, ct.ID, record.Name, country.AltSpellings); err != nil {
+				return err
+			}
 		}
 
-		return nil
+		if err := seedCountryGroups(tx); err != nil {
+			return err
+		}
+		if err := upsertCurrencies(tx, *countries, rates, s.baseCurrency, now); err != nil {
+			return err
+		}
+		if err := repository.BumpDatasetVersion(tx); err != nil {
+			return err
+		}
+		return repository.RecordRefresh(tx, now)
 	})
 
 	if err != nil {
 		return dto.RefreshCountriesResponse{}, err
 	}
+	s.datasetRepository.NotifyChanged()
 
-	// Generate summary image after successful refresh
-	totalCount, _, err := s.countryRepository.GetStats()
-	if err == nil {
-		topCountries, err := s.countryRepository.GetTopCountriesByGDP(5)
-		if err == nil {
-			// Generate the image with current timestamp
-			_ = utils.GenerateSummaryImage(int(totalCount), topCountries, time.Now(), "cache/summary.png")
-		}
-	}
+	// Summary images of the old data are stale now. The default one is
+	// rendered straight away, the others on their next request.
+	_ = os.RemoveAll(summaryImageDir)
+	_, _ = s.GetSummaryImage(dto.SummaryImageOptions{})
 
 	response := dto.RefreshCountriesResponse{
 		Status: "Successfully refreshed countries",
@@ -157,6 +270,18 @@ func (s countryService) RefreshCountries() (dto.RefreshCountriesResponse, error)
 	return response, nil
 }
 
+func (s countryService) GetDatasetState() (*dto.DatasetState, error) {
+	state, err := s.datasetRepository.GetState()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.DatasetState{
+		Version:      state.Version,
+		LastModified: state.LastModified,
+	}, nil
+}
+
 func (s countryService) GetStats() (*dto.GetCountryStatsResponse, error) {
 	countriesCount, lastRefreshedTime, err := s.countryRepository.GetStats()
 	if err != nil {
@@ -171,67 +296,79 @@ func (s countryService) GetStats() (*dto.GetCountryStatsResponse, error) {
 	return &statistics, nil
 }
 
-func (s countryService) GetCountryByName(name string) (*dto.GetCountryByNameResponse, error) {
-	// Normalize the name
-	normalizedName := strings.ToLower(name)
-	// Call the repo method
-	country, err := s.countryRepository.GetCountryByName(normalizedName)
+func (s countryService) GetCountryByName(name string, shape dto.ShapeOptions) (*dto.ShapedCountry, error) {
+	countryShape, err := s.resolveShape(shape)
 	if err != nil {
-		return nil, errors.New("Country not found")
+		return nil, err
 	}
 
-	// Convert to DTO with ISO 8601 formatted timestamp
-	response := &dto.GetCountryByNameResponse{
-		ID:              country.ID,
-		Name:            country.Name,
-		Capital:         country.Capital,
-		Region:          country.Region,
-		Population:      country.Population,
-		CurrencyCode:    country.CurrencyCode,
-		ExchangeRate:    country.ExchangeRate,
-		EstimatedGDP:    country.EstimatedGDP,
-		FlagURL:         country.FlagURL,
-		LastRefreshedAt: country.LastRefreshedAt.Format(time.RFC3339),
+	// Resolve the name, slug or ISO code
+	country, err := s.findCountry(name, countryShape.columns...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
 	}
 
-	return response, nil
+	// Convert to the shaped DTO with ISO 8601 formatted timestamp
+	shaped, err := countryShape.apply(s, []models.Country{*country})
+	if err != nil {
+		return nil, err
+	}
+
+	return &shaped[0], nil
 }
 
-func (s countryService) DeleteCountryByName(name string) error {
-	// Normalize the name
-	normalizedName := strings.ToLower(name)
-	// Call the repo method
-	err := s.countryRepository.DeleteCountryByName(normalizedName)
+// DeleteCountryByName deletes one country, keeping it recoverable like a
+// bulk delete
+func (s countryService) DeleteCountryByName(ctx context.Context, name string, precondition Precondition) error {
+	// Resolve the name, slug, alias or ISO code
+	country, err := s.findCountry(name)
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.countryNotFound(name)
+		}
 		return errors.New("Failed to delete country")
 	}
+	if !precondition.matches(country) {
+		return &PreconditionFailedError{
+			Message: "Precondition failed",
+			Current: toFilterCountriesResponse(*country),
+		}
+	}
 
+	if _, err := s.deleteCountries(ctx, []models.Country{*country}); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return s.preconditionFailed(country.ID)
+		}
+		return errors.New("Failed to delete country")
+	}
 	return nil
 }
 
-func (s countryService) GetAllCountries(region string, currency string, sort string) ([]dto.FilterCountriesResponse, error) {
-	countries, err := s.countryRepository.GetAllCountriesWithFilters(region, currency, sort)
+func (s countryService) GetAllCountries(region string, currency string, sort string, group string, meta map[string][]string, shape dto.ShapeOptions) ([]dto.ShapedCountry, error) {
+	countryShape, err := s.resolveShape(shape)
 	if err != nil {
 		return nil, err
 	}
-	var res []dto.FilterCountriesResponse
-
-	for _, country := range *countries {
-		record := dto.FilterCountriesResponse{
-			ID:              country.ID,
-			Name:            country.Name,
-			Capital:         country.Capital,
-			Region:          country.Region,
-			Population:      country.Population,
-			CurrencyCode:    country.CurrencyCode,
-			ExchangeRate:    country.ExchangeRate,
-			EstimatedGDP:    country.EstimatedGDP,
-			FlagURL:         country.FlagURL,
-			LastRefreshedAt: country.LastRefreshedAt.Format(time.RFC3339),
+	filter, err := metadataFilter(meta)
+	if err != nil {
+		return nil, err
+	}
+	var groupID uint
+	if strings.TrimSpace(group) != "" {
+		countryGroup, err := s.findGroup(group)
+		if err != nil {
+			return nil, err
 		}
+		groupID = countryGroup.ID
+	}
 
-		res = append(res, record)
+	countries, err := s.countryRepository.GetAllCountriesWithFilters(region, currency, sort, groupID, filter, countryShape.columns...)
+	if err != nil {
+		return nil, err
 	}
 
-	return res, nil
+	return countryShape.apply(s, *countries)
 }
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"time"
+)
+
+// countryEmbedder loads related data for the embed query parameter.
+type countryEmbedder struct {
+	// columns the loader needs on the country rows
+	columns []string
+	load    func(s countryService, shape *countryShape, countries []models.Country) (map[uint]interface{}, error)
+}
+
+var countryEmbedders = map[string]countryEmbedder{
+	"currency": {
+		columns: []string{"currency_code", "exchange_rate"},
+		load:    loadCurrencyEmbed,
+	},
+	"rate_history": {
+		columns: []string{"currency_code"},
+		load:    loadRateHistoryEmbed,
+	},
+}
+
+// rateHistoryWindow is how far back the rate_history embed reaches
+const rateHistoryWindow = 30 * 24 * time.Hour
+
+// countryShape is a validated set of ShapeOptions.
+type countryShape struct {
+	fields  []string
+	columns []string
+	embeds  []string
+	// rate of the requested currency base against the configured one,
+	// nil when no rebasing is needed
+	baseRate *float64
+	// the requested currency base, set along with baseRate
+	baseCode string
+}
+
+// resolveShape validates the requested fields, exclusions, embeds and
+// currency base and works out which columns need to be selected to serve them.
+func (s countryService) resolveShape(opts dto.ShapeOptions) (*countryShape, error) {
+	known := make(map[string]bool, len(dto.CountryFields))
+	for _, f := range dto.CountryFields {
+		known[f] = true
+	}
+
+	validationDetails := make(map[string]string)
+	var unknown []string
+	for _, f := range append(append([]string{}, opts.Fields...), opts.Exclude...) {
+		if !known[f] {
+			unknown = append(unknown, f)
+		}
+	}
+	if len(unknown) > 0 {
+		validationDetails["fields"] = fmt.Sprintf("unknown field(s): %s", strings.Join(unknown, ", "))
+	}
+
+	var unknownEmbeds []string
+	for _, e := range opts.Embed {
+		if _, ok := countryEmbedders[e]; !ok {
+			unknownEmbeds = append(unknownEmbeds, e)
+		}
+	}
+	if len(unknownEmbeds) > 0 {
+		validationDetails["embed"] = fmt.Sprintf("unknown embed(s): %s", strings.Join(unknownEmbeds, ", "))
+	}
+
+	var baseRate *float64
+	var baseCode string
+	currencyBase := strings.ToUpper(strings.TrimSpace(opts.CurrencyBase))
+	if currencyBase != "" && currencyBase != s.baseCurrency {
+		rate, err := s.rateFor(currencyBase, nil)
+		if err != nil {
+			var valErr *ValidationError
+			if !errors.As(err, &valErr) {
+				return nil, err
+			}
+			validationDetails["currency_base"] = valErr.Details["currency"]
+		} else {
+			baseRate = &rate.Rate
+			baseCode = currencyBase
+		}
+	}
+
+	if len(validationDetails) > 0 {
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: validationDetails,
+		}
+	}
+
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = dto.CountryFields
+	}
+	excluded := make(map[string]bool, len(opts.Exclude))
+	for _, f := range opts.Exclude {
+		excluded[f] = true
+	}
+
+	shape := &countryShape{embeds: opts.Embed, baseRate: baseRate, baseCode: baseCode}
+	for _, f := range fields {
+		if !excluded[f] {
+			shape.fields = append(shape.fields, f)
+		}
+	}
+
+	// Only narrow the SELECT when the client actually trimmed the response
+	if len(opts.Fields) > 0 || len(opts.Exclude) > 0 {
+		columns := map[string]bool{"id": true}
+		shape.columns = []string{"id"}
+		add := func(col string) {
+			if !columns[col] {
+				columns[col] = true
+				shape.columns = append(shape.columns, col)
+			}
+		}
+		for _, f := range shape.fields {
+			if !dto.IsComputedCountryField(f) {
+				add(f)
+			}
+		}
+		for _, e := range shape.embeds {
+			for _, col := range countryEmbedders[e].columns {
+				add(col)
+			}
+		}
+	}
+
+	return shape, nil
+}
+
+// apply projects the countries onto the shape and attaches any embeds.
+func (shape *countryShape) apply(s countryService, countries []models.Country) ([]dto.ShapedCountry, error) {
+	ids := make([]uint, 0, len(countries))
+	for _, country := range countries {
+		ids = append(ids, country.ID)
+	}
+	overrides, err := s.overrideRepository.GetOverridesForCountries(ids)
+	if err != nil {
+		return nil, err
+	}
+	countries = append([]models.Country{}, countries...)
+	overridden, err := s.applyOverrides(countries, overrides, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata map[uint]map[string]interface{}
+	if shape.includes(dto.MetadataKey) {
+		entries, err := s.metadataRepository.GetMetadataForCountries(ids)
+		if err != nil {
+			return nil, err
+		}
+		metadata = groupMetadata(entries)
+	}
+
+	if shape.baseRate != nil {
+		countries = rebaseCountries(countries, *shape.baseRate)
+	}
+
+	embedded := make(map[string]map[uint]interface{}, len(shape.embeds))
+	for _, e := range shape.embeds {
+		values, err := countryEmbedders[e].load(s, shape, countries)
+		if err != nil {
+			return nil, err
+		}
+		embedded[e] = values
+	}
+
+	var res []dto.ShapedCountry
+	for _, country := range countries {
+		record := toFilterCountriesResponse(country).Shape(shape.fields)
+		if _, ok := record.Get(dto.OverriddenFieldsKey); ok {
+			record.Set(dto.OverriddenFieldsKey, overriddenList(overridden[country.ID]))
+		}
+		if _, ok := record.Get(dto.MetadataKey); ok {
+			record.Set(dto.MetadataKey, metadataObject(metadata[country.ID]))
+		}
+		for _, e := range shape.embeds {
+			record.Set(e, embedded[e][country.ID])
+		}
+		res = append(res, record)
+	}
+	return res, nil
+}
+
+// includes reports whether the shape returns field
+func (shape *countryShape) includes(field string) bool {
+	for _, f := range shape.fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// overriddenList keeps an empty list from encoding as null
+func overriddenList(fields []string) []string {
+	if fields == nil {
+		return []string{}
+	}
+	return fields
+}
+
+// rebaseCountries requotes exchange rates and GDP estimates against another
+// base currency, given that currency's rate against the configured base.
+func rebaseCountries(countries []models.Country, baseRate float64) []models.Country {
+	rebased := make([]models.Country, len(countries))
+	for i, country := range countries {
+		if country.ExchangeRate != nil {
+			rate := *country.ExchangeRate / baseRate
+			country.ExchangeRate = &rate
+		}
+		if country.EstimatedGDP != nil {
+			gdp := *country.EstimatedGDP * baseRate
+			country.EstimatedGDP = &gdp
+		}
+		rebased[i] = country
+	}
+	return rebased
+}
+
+func toFilterCountriesResponse(country models.Country) dto.FilterCountriesResponse {
+	return dto.FilterCountriesResponse{
+		ID:              country.ID,
+		Name:            country.Name,
+		Alpha2Code:      country.Alpha2Code,
+		Alpha3Code:      country.Alpha3Code,
+		Slug:            country.Slug,
+		Capital:         country.Capital,
+		Region:          country.Region,
+		Population:      country.Population,
+		CurrencyCode:    country.CurrencyCode,
+		ExchangeRate:    country.ExchangeRate,
+		EstimatedGDP:    country.EstimatedGDP,
+		FlagURL:         country.FlagURL,
+		LastRefreshedAt: country.LastRefreshedAt.Format(time.RFC3339),
+		Version:         country.Version,
+	}
+}
+
+func loadCurrencyEmbed(s countryService, shape *countryShape, countries []models.Country) (map[uint]interface{}, error) {
+	currencies, err := s.currencyRepository.GetCurrenciesByCodes(currencyCodes(countries))
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]models.Currency, len(currencies))
+	for _, currency := range currencies {
+		byCode[currency.Code] = currency
+	}
+
+	values := make(map[uint]interface{}, len(countries))
+	for _, country := range countries {
+		if country.CurrencyCode == nil {
+			continue
+		}
+		currency := byCode[*country.CurrencyCode]
+		values[country.ID] = dto.CurrencyEmbed{
+			Code:         *country.CurrencyCode,
+			Name:         currency.Name,
+			Symbol:       currency.Symbol,
+			ExchangeRate: country.ExchangeRate,
+		}
+	}
+	return values, nil
+}
+
+// loadRateHistoryEmbed lists the recorded rates of each country's currency.
+// With a currency base, every rate is requoted against the base's rate from
+// the same refresh; rates from refreshes that did not record the base are
+// left out.
+func loadRateHistoryEmbed(s countryService, shape *countryShape, countries []models.Country) (map[uint]interface{}, error) {
+	codes := currencyCodes(countries)
+	if shape.baseRate != nil {
+		codes = append(codes, shape.baseCode)
+	}
+	history, err := s.currencyRepository.GetRateHistory(codes, s.baseCurrency, time.Now().Add(-rateHistoryWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	var baseRates map[int64]float64
+	if shape.baseRate != nil {
+		baseRates = make(map[int64]float64)
+		for _, entry := range history {
+			if entry.CurrencyCode == shape.baseCode && entry.Rate > 0 {
+				baseRates[entry.FetchedAt.UnixNano()] = entry.Rate
+			}
+		}
+	}
+
+	byCode := make(map[string][]dto.RateHistoryEntry)
+	for _, entry := range history {
+		rate := entry.Rate
+		baseCode := entry.BaseCode
+		if baseRates != nil {
+			baseRate, ok := baseRates[entry.FetchedAt.UnixNano()]
+			if !ok {
+				continue
+			}
+			rate /= baseRate
+			baseCode = shape.baseCode
+		}
+		byCode[entry.CurrencyCode] = append(byCode[entry.CurrencyCode], dto.RateHistoryEntry{
+			Rate:      rate,
+			BaseCode:  baseCode,
+			FetchedAt: entry.FetchedAt.Format(time.RFC3339),
+		})
+	}
+
+	values := make(map[uint]interface{}, len(countries))
+	for _, country := range countries {
+		entries := []dto.RateHistoryEntry{}
+		if country.CurrencyCode != nil && byCode[*country.CurrencyCode] != nil {
+			entries = byCode[*country.CurrencyCode]
+		}
+		values[country.ID] = entries
+	}
+	return values, nil
+}
+
+// currencyCodes returns the distinct currency codes of the countries
+func currencyCodes(countries []models.Country) []string {
+	var codes []string
+	seen := make(map[string]bool)
+	for _, country := range countries {
+		if country.CurrencyCode != nil && !seen[*country.CurrencyCode] {
+			seen[*country.CurrencyCode] = true
+			codes = append(codes, *country.CurrencyCode)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"task_2/dto"
+	"task_2/models"
+	"task_2/repository"
+	"task_2/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Precondition is the If-Match header of a write: either any current
+// version, or the country versions the client last saw.
+type Precondition struct {
+	Any      bool
+	Versions []dto.CountryVersion
+}
+
+func (p Precondition) matches(country *models.Country) bool {
+	if p.Any {
+		return true
+	}
+	for _, version := range p.Versions {
+		if version.ID == country.ID && version.Version == country.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// PreconditionFailedError is returned when a write's If-Match no longer
+// matches. It carries the current country so the client can merge.
+type PreconditionFailedError struct {
+	Message string
+	Current dto.FilterCountriesResponse
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return e.Message
+}
+
+// preconditionFailed reloads the country for a PreconditionFailedError
+func (s countryService) preconditionFailed(countryID uint) error {
+	country, err := s.countryRepository.GetCountryByID(countryID)
+	if err != nil {
+		return err
+	}
+	return &PreconditionFailedError{
+		Message: "Precondition failed",
+		Current: toFilterCountriesResponse(*country),
+	}
+}
+
+// GetCountryVersion returns the current version of a country for its ETag
+func (s countryService) GetCountryVersion(name string) (*dto.CountryVersion, error) {
+	country, err := s.findCountry(name, "id", "version", "updated_at")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+	return &dto.CountryVersion{
+		ID:        country.ID,
+		Version:   country.Version,
+		UpdatedAt: country.UpdatedAt,
+	}, nil
+}
+
+// validateCountry holds the rules every stored country must satisfy, whether
+// it comes from the refresh or from the API.
+func validateCountry(name string, population int64, hasCurrency bool, currencyCode *string) map[string]string {
+	details := make(map[string]string)
+	if strings.TrimSpace(name) == "" {
+		details["name"] = "is required"
+	}
+	if population < 0 {
+		details["population"] = "must be non-negative"
+	}
+	if hasCurrency && (currencyCode == nil || strings.TrimSpace(*currencyCode) == "") {
+		details["currency_code"] = "is required"
+	}
+	return details
+}
+
+// validateCountryRequest applies validateCountry to a request body, plus the
+// format checks for fields that upstream data is trusted on.
+func validateCountryRequest(request dto.CountryRequest) error {
+	var population int64
+	if request.Population != nil {
+		population = *request.Population
+	}
+
+	details := validateCountry(request.Name, population, request.CurrencyCode != nil, request.CurrencyCode)
+	if request.Population == nil {
+		details["population"] = "is required"
+	}
+	if request.Alpha2Code != "" && !isLetterCode(request.Alpha2Code, 2) {
+		details["alpha2_code"] = "must be a 2-letter ISO 3166-1 code"
+	}
+	if request.Alpha3Code != "" && !isLetterCode(request.Alpha3Code, 3) {
+		details["alpha3_code"] = "must be a 3-letter ISO 3166-1 code"
+	}
+	if _, ok := details["currency_code"]; !ok && request.CurrencyCode != nil && !isLetterCode(strings.TrimSpace(*request.CurrencyCode), 3) {
+		details["currency_code"] = "must be a 3-letter ISO 4217 code"
+	}
+
+	if len(details) > 0 {
+		return &ValidationError{
+			Message: "Validation failed",
+			Details: details,
+		}
+	}
+	return nil
+}
+
+func isLetterCode(code string, length int) bool {
+	if len(code) != length {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// applyCountryRequest copies a validated request onto country
+func applyCountryRequest(country *models.Country, request dto.CountryRequest) {
+	country.Name = strings.TrimSpace(request.Name)
+	country.Alpha2Code = strings.ToUpper(request.Alpha2Code)
+	country.Alpha3Code = strings.ToUpper(request.Alpha3Code)
+	country.Slug = utils.Slugify(country.Name)
+	country.Capital = request.Capital
+	country.Region = request.Region
+	country.Population = *request.Population
+	country.FlagURL = request.FlagURL
+	country.CurrencyCode = nil
+	if request.CurrencyCode != nil {
+		code := strings.ToUpper(strings.TrimSpace(*request.CurrencyCode))
+		country.CurrencyCode = &code
+	}
+}
+
+// toCountryRequest is the document PATCH merges into
+func toCountryRequest(country models.Country) dto.CountryRequest {
+	population := country.Population
+	return dto.CountryRequest{
+		Name:         country.Name,
+		Alpha2Code:   country.Alpha2Code,
+		Alpha3Code:   country.Alpha3Code,
+		Capital:      country.Capital,
+		Region:       country.Region,
+		Population:   &population,
+		CurrencyCode: country.CurrencyCode,
+		FlagURL:      country.FlagURL,
+	}
+}
+
+// priceCountry sets the exchange rate and estimated GDP like the refresh
+// does: no currency gives a GDP of 0, a currency without a known rate gives
+// neither.
+func (s countryService) priceCountry(country *models.Country) error {
+	country.ExchangeRate = nil
+	country.EstimatedGDP = nil
+
+	if country.CurrencyCode == nil {
+		zero := float64(0)
+		country.EstimatedGDP = &zero
+		return nil
+	}
+
+	currency, err := s.currencyRepository.GetCurrencyByCode(*country.CurrencyCode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if currency.ExchangeRate != nil && *currency.ExchangeRate > 0 {
+		rate := *currency.ExchangeRate
+		estimated := utils.ComputeEstimatedGDP(country.Population, rate)
+		country.ExchangeRate = &rate
+		country.EstimatedGDP = &estimated
+	}
+	return nil
+}
+
+// priceFromRates is priceCountry for the refresh, which prices against the
+// freshly fetched rates rather than the stored currencies.
+func priceFromRates(country *models.Country, rates map[string]float64) {
+	country.ExchangeRate = nil
+	country.EstimatedGDP = nil
+
+	if country.CurrencyCode == nil {
+		zero := float64(0)
+		country.EstimatedGDP = &zero
+		return
+	}
+	if r, ok := rates[*country.CurrencyCode]; ok && r > 0 {
+		rate := r
+		estimated := utils.ComputeEstimatedGDP(country.Population, rate)
+		country.ExchangeRate = &rate
+		country.EstimatedGDP = &estimated
+	}
+}
+
+// checkNameAvailable fails with a ConflictError when another country than
+// countryID already has the name or its slug.
+func (s countryService) checkNameAvailable(name string, countryID uint) error {
+	existing, err := s.countryRepository.GetCountryByName(strings.TrimSpace(name), "id")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing, err = s.countryRepository.GetCountryBySlug(utils.Slugify(name), "id")
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if existing.ID == countryID {
+		return nil
+	}
+	return &ConflictError{
+		Message: "Country already exists",
+		Details: map[string]string{"name": "is already used by another country"},
+	}
+}
+
+// checkCodesAvailable fails with a ConflictError when another country than
+// countryID already has the alpha-2 or alpha-3 code of request, since codes
+// resolve countries in lookups
+func (s countryService) checkCodesAvailable(request dto.CountryRequest, countryID uint) error {
+	details := make(map[string]string)
+	codes := []struct {
+		field string
+		code  string
+	}{
+		{"alpha2_code", request.Alpha2Code},
+		{"alpha3_code", request.Alpha3Code},
+	}
+	for _, c := range codes {
+		if c.code == "" {
+			continue
+		}
+		existing, err := s.countryRepository.GetCountryByCode(c.code, "id", "name")
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		if existing.ID != countryID {
+			details[c.field] = fmt.Sprintf("is already used by %s", existing.Name)
+		}
+	}
+
+	if len(details) > 0 {
+		return &ConflictError{
+			Message: "Country code already exists",
+			Details: details,
+		}
+	}
+	return nil
+}
+
+// checkOverriddenFields fails with a ConflictError when request changes a
+// field under an active override. Reads show the override, so the edit
+// would otherwise be lost.
+func (s countryService) checkOverriddenFields(country *models.Country, request dto.CountryRequest) error {
+	overrides, err := s.overrideRepository.GetOverridesForCountries([]uint{country.ID})
+	if err != nil {
+		return err
+	}
+
+	updated := *country
+	applyCountryRequest(&updated, request)
+	now := time.Now()
+	details := make(map[string]string)
+	for _, override := range overrides {
+		if !override.Active(now) {
+			continue
+		}
+		current := countryFieldValue(country, override.Field)
+		next := countryFieldValue(&updated, override.Field)
+		if (current == nil) != (next == nil) || (current != nil && *current != *next) {
+			details[override.Field] = fmt.Sprintf("has an active override, remove it with DELETE /countries/%s/overrides/%s first", country.Slug, override.Field)
+		}
+	}
+	if len(details) > 0 {
+		return &ConflictError{
+			Message: "Field is overridden",
+			Details: details,
+		}
+	}
+	return nil
+}
+
+func (s countryService) CreateCountry(ctx context.Context, request dto.CountryRequest) (*dto.FilterCountriesResponse, error) {
+	if err := validateCountryRequest(request); err != nil {
+		return nil, err
+	}
+	if err := s.checkNameAvailable(request.Name, 0); err != nil {
+		return nil, err
+	}
+	if err := s.checkCodesAvailable(request, 0); err != nil {
+		return nil, err
+	}
+
+	var country models.Country
+	applyCountryRequest(&country, request)
+	if err := s.priceCountry(&country); err != nil {
+		return nil, err
+	}
+	country.LastRefreshedAt = time.Now()
+	country.Version = 1
+
+	if _, err := s.countryRepository.CreateNewCountry(ctx, &country); err != nil {
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	response := toFilterCountriesResponse(country)
+	return &response, nil
+}
+
+func (s countryService) ReplaceCountry(ctx context.Context, name string, precondition Precondition, request dto.CountryRequest) (*dto.FilterCountriesResponse, error) {
+	country, err := s.findCountry(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+	return s.updateCountry(ctx, country, precondition, request)
+}
+
+// PatchCountry applies an RFC 7386 JSON Merge Patch to the country's
+// CountryRequest document, then saves it like ReplaceCountry.
+func (s countryService) PatchCountry(ctx context.Context, name string, precondition Precondition, patch map[string]interface{}) (*dto.FilterCountriesResponse, error) {
+	country, err := s.findCountry(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, s.countryNotFound(name)
+		}
+		return nil, err
+	}
+
+	current, err := json.Marshal(toCountryRequest(*country))
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return nil, err
+	}
+	var request dto.CountryRequest
+	if err := json.Unmarshal(merged, &request); err != nil {
+		details := map[string]string{"body": "must be a JSON merge patch of a country"}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			details = map[string]string{typeErr.Field: "has the wrong type"}
+		}
+		return nil, &ValidationError{
+			Message: "Validation failed",
+			Details: details,
+		}
+	}
+
+	return s.updateCountry(ctx, country, precondition, request)
+}
+
+// updateCountry validates request and writes it over country, provided the
+// precondition holds. The estimated GDP is recomputed only when the
+// population or currency changes, since it carries a random multiplier.
+func (s countryService) updateCountry(ctx context.Context, country *models.Country, precondition Precondition, request dto.CountryRequest) (*dto.FilterCountriesResponse, error) {
+	if !precondition.matches(country) {
+		return nil, &PreconditionFailedError{
+			Message: "Precondition failed",
+			Current: toFilterCountriesResponse(*country),
+		}
+	}
+	if err := validateCountryRequest(request); err != nil {
+		return nil, err
+	}
+	if err := s.checkNameAvailable(request.Name, country.ID); err != nil {
+		return nil, err
+	}
+	if err := s.checkCodesAvailable(request, country.ID); err != nil {
+		return nil, err
+	}
+	if err := s.checkOverriddenFields(country, request); err != nil {
+		return nil, err
+	}
+
+	previousPopulation := country.Population
+	previousCurrency := ""
+	if country.CurrencyCode != nil {
+		previousCurrency = *country.CurrencyCode
+	}
+
+	applyCountryRequest(country, request)
+
+	currency := ""
+	if country.CurrencyCode != nil {
+		currency = *country.CurrencyCode
+	}
+	if country.Population != previousPopulation || currency != previousCurrency {
+		if err := s.priceCountry(country); err != nil {
+			return nil, err
+		}
+	}
+	country.LastRefreshedAt = time.Now()
+
+	// A write that lands between our read and this update wins
+	if err := s.countryRepository.UpdateCountry(ctx, country.ID, country.Version, country); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, s.preconditionFailed(country.ID)
+		}
+		return nil, err
+	}
+	if err := s.datasetRepository.BumpVersion(); err != nil {
+		return nil, err
+	}
+
+	response := toFilterCountriesResponse(*country)
+	return &response, nil
+}
+
+// mergePatch applies an RFC 7386 JSON Merge Patch to target: null removes a
+// member, objects merge recursively and anything else replaces.
+func mergePatch(target map[string]interface{}, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if patchObject, ok := value.(map[string]interface{}); ok {
+			targetObject, _ := target[key].(map[string]interface{})
+			if targetObject == nil {
+				targetObject = make(map[string]interface{})
+			}
+			target[key] = mergePatch(targetObject, patchObject)
+			continue
+		}
+		target[key] = value
+	}
+	return target
+}
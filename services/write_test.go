@@ -0,0 +1,46 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestMergePatch runs the examples from RFC 7386 appendix A on objects
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{name: "replace member", target: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add member", target: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "null deletes member", target: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "null deletes only that member", target: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "value replaces array", target: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "array replaces value", target: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "nested merge and delete", target: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", target: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "null of missing member", target: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{name: "nested null creates no member", target: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+		{name: "object replaces scalar", target: `{"a":"foo"}`, patch: `{"a":{"b":"c"}}`, want: `{"a":{"b":"c"}}`},
+		{name: "empty patch", target: `{"a":"b"}`, patch: `{}`, want: `{"a":"b"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode := func(raw string) map[string]interface{} {
+				var doc map[string]interface{}
+				if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+					t.Fatal(err)
+				}
+				return doc
+			}
+			target, patch, want := decode(tt.target), decode(tt.patch), decode(tt.want)
+			if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+				t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+			}
+		})
+	}
+}
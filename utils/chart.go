@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// Chart layout, in pixels
+const (
+	// axisHeight is the space under a plot for tick labels and the axis title
+	axisHeight = 38
+	// minBarRowHeight is the least height a bar and its label get
+	minBarRowHeight = 16
+)
+
+// ScatterPoint is one country on the population vs GDP panel
+type ScatterPoint struct {
+	Population float64
+	GDP        float64
+	// Highlight marks the countries shown in the bar chart
+	Highlight bool
+}
+
+// compactUnits are the suffixes of FormatCompact, largest first
+var compactUnits = []struct {
+	size   float64
+	suffix string
+}{
+	{1e12, "T"},
+	{1e9, "B"},
+	{1e6, "M"},
+	{1e3, "K"},
+}
+
+// FormatCompact shortens value with a K, M, B or T suffix, keeping one
+// decimal below 100 of the unit: 1234567 is 1.2M, 330000000 is 330M.
+func FormatCompact(value float64) string {
+	abs := math.Abs(value)
+	for i, unit := range compactUnits {
+		if abs < unit.size {
+			continue
+		}
+		scaled := value / unit.size
+		// 999.96K would round to 1000K, which is 1M
+		if math.Abs(math.Round(scaled)) >= 1000 && i > 0 {
+			return formatScaled(value/compactUnits[i-1].size) + compactUnits[i-1].suffix
+		}
+		return formatScaled(scaled) + unit.suffix
+	}
+	if math.Abs(math.Round(value)) >= 1000 {
+		return formatScaled(value/1e3) + "K"
+	}
+	return formatScaled(value)
+}
+
+func formatScaled(value float64) string {
+	if math.Abs(value) >= 100 {
+		return strconv.FormatFloat(value, 'f', 0, 64)
+	}
+	formatted := strconv.FormatFloat(value, 'f', 1, 64)
+	return strings.TrimSuffix(formatted, ".0")
+}
+
+// formatMetric formats a value of the summary metric for a chart label.
+// GDP values carry the code of the currency they are quoted in.
+func formatMetric(value float64, metric string, currency string) string {
+	if metric == MetricPopulation || currency == "" {
+		return FormatCompact(value)
+	}
+	return FormatCompact(value) + " " + currency
+}
+
+// niceStep rounds span/count up to 1, 2 or 5 times a power of ten, so axis
+// ticks fall on round numbers
+func niceStep(span float64, count int) float64 {
+	raw := span / float64(count)
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, multiple := range []float64{1, 2, 5} {
+		if raw <= multiple*magnitude {
+			return multiple * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// drawBarChart draws entries as horizontal bars in area, largest first as
+// given, with names on the left, values at the end of the bars and the value
+// axis underneath
+func drawBarChart(img *image.RGBA, area image.Rectangle, entries []SummaryEntry, metric string, currency string, theme *ImageTheme, face font.Face, smallFace font.Face) {
+	plot := image.Rect(area.Min.X, area.Min.Y, area.Max.X, area.Max.Y-axisHeight)
+	if len(entries) == 0 {
+		drawTextCentered(img, plot.Min.X+plot.Dx()/2, textMiddle(plot.Min.Y+plot.Dy()/2, face), "No data", face, theme.Muted)
+		return
+	}
+
+	rowHeight := plot.Dy() / len(entries)
+	labelFace := face
+	if rowHeight < 22 {
+		labelFace = smallFace
+	}
+
+	// Names take up to a third of the width, values what their widest needs
+	maxValue := 0.0
+	nameWidth := 0
+	valueWidth := 0
+	values := make([]string, len(entries))
+	for i, entry := range entries {
+		maxValue = math.Max(maxValue, entry.Value)
+		values[i] = formatMetric(entry.Value, metric, currency)
+		nameWidth = max(nameWidth, MeasureText(labelFace, entry.Name))
+		valueWidth = max(valueWidth, MeasureText(labelFace, values[i]))
+	}
+	nameWidth = min(nameWidth, plot.Dx()/3)
+	barLeft := plot.Min.X + nameWidth + 10
+	barRight := plot.Max.X - valueWidth - 8
+
+	if maxValue <= 0 {
+		maxValue = 1
+	}
+	step := niceStep(maxValue, 4)
+	top := math.Ceil(maxValue/step) * step
+	scale := float64(barRight-barLeft) / top
+
+	// Grid lines and tick labels
+	grid := withAlpha(theme.Muted, 70)
+	for i := 0; float64(i)*step <= top+step/2; i++ {
+		x := barLeft + int(float64(i)*step*scale)
+		fillRect(img, image.Rect(x, plot.Min.Y, x+1, plot.Max.Y), grid)
+		drawTextCentered(img, x, plot.Max.Y+16, formatMetric(float64(i)*step, metric, currency), smallFace, theme.Muted)
+	}
+	fillRect(img, image.Rect(barLeft, plot.Min.Y, barLeft+1, plot.Max.Y), theme.Muted)
+	fillRect(img, image.Rect(barLeft, plot.Max.Y-1, barRight, plot.Max.Y), theme.Muted)
+	drawTextCentered(img, barLeft+(barRight-barLeft)/2, plot.Max.Y+34, metricTitle(metric), smallFace, theme.Text)
+
+	barHeight := min(max(rowHeight*65/100, 6), 28)
+	for i, entry := range entries {
+		middle := plot.Min.Y + rowHeight*i + rowHeight/2
+		barEnd := barLeft + 1 + int(math.Max(entry.Value, 0)*scale)
+		fillRect(img, image.Rect(barLeft+1, middle-barHeight/2, barEnd, middle-barHeight/2+barHeight), theme.Accent)
+
+		baseline := textMiddle(middle, labelFace)
+		name := TruncateText(labelFace, entry.Name, nameWidth)
+		drawText(img, barLeft-8-MeasureText(labelFace, name), baseline, name, labelFace, theme.Text)
+		drawText(img, barEnd+6, baseline, values[i], labelFace, theme.Text)
+	}
+}
+
+// drawScatter plots GDP against population on log scales in area. The
+// highlighted countries are drawn last so they stay visible.
+func drawScatter(img *image.RGBA, area image.Rectangle, points []ScatterPoint, currency string, theme *ImageTheme, face font.Face, smallFace font.Face) {
+	drawText(img, area.Min.X, area.Min.Y+14, TruncateText(face, "Population vs GDP", area.Dx()), face, theme.Title)
+
+	var valid []ScatterPoint
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		// Log scales can't show zero
+		if point.Population <= 0 || point.GDP <= 0 {
+			continue
+		}
+		valid = append(valid, point)
+		minX = math.Min(minX, math.Log10(point.Population))
+		maxX = math.Max(maxX, math.Log10(point.Population))
+		minY = math.Min(minY, math.Log10(point.GDP))
+		maxY = math.Max(maxY, math.Log10(point.GDP))
+	}
+	if len(valid) == 0 {
+		middle := area.Min.Y + area.Dy()/2
+		drawTextCentered(img, area.Min.X+area.Dx()/2, textMiddle(middle, face), "No data", face, theme.Muted)
+		return
+	}
+
+	// Axes span whole powers of ten
+	xFrom, xTo := math.Floor(minX), math.Ceil(maxX)
+	yFrom, yTo := math.Floor(minY), math.Ceil(maxY)
+	if xTo == xFrom {
+		xTo++
+	}
+	if yTo == yFrom {
+		yTo++
+	}
+
+	labelWidth := 0
+	for power := yFrom; power <= yTo; power++ {
+		labelWidth = max(labelWidth, MeasureText(smallFace, formatMetric(math.Pow(10, power), MetricGDP, currency)))
+	}
+	plot := image.Rect(area.Min.X+labelWidth+8, area.Min.Y+44, area.Max.X-10, area.Max.Y-axisHeight)
+	toX := func(value float64) float64 {
+		return float64(plot.Min.X) + (math.Log10(value)-xFrom)/(xTo-xFrom)*float64(plot.Dx())
+	}
+	toY := func(value float64) float64 {
+		return float64(plot.Max.Y) - (math.Log10(value)-yFrom)/(yTo-yFrom)*float64(plot.Dy())
+	}
+
+	// Label every power of ten unless the labels would crowd
+	grid := withAlpha(theme.Muted, 70)
+	xEvery := max(1, int(math.Ceil((xTo-xFrom)*50/float64(plot.Dx()))))
+	for power := xFrom; power <= xTo; power += float64(xEvery) {
+		x := int(toX(math.Pow(10, power)))
+		fillRect(img, image.Rect(x, plot.Min.Y, x+1, plot.Max.Y), grid)
+		drawTextCentered(img, x, plot.Max.Y+16, FormatCompact(math.Pow(10, power)), smallFace, theme.Muted)
+	}
+	yEvery := max(1, int(math.Ceil((yTo-yFrom)*24/float64(plot.Dy()))))
+	for power := yFrom; power <= yTo; power += float64(yEvery) {
+		y := int(toY(math.Pow(10, power)))
+		fillRect(img, image.Rect(plot.Min.X, y, plot.Max.X, y+1), grid)
+		label := formatMetric(math.Pow(10, power), MetricGDP, currency)
+		drawText(img, plot.Min.X-8-MeasureText(smallFace, label), textMiddle(y, smallFace), label, smallFace, theme.Muted)
+	}
+	fillRect(img, image.Rect(plot.Min.X, plot.Min.Y, plot.Min.X+1, plot.Max.Y), theme.Muted)
+	fillRect(img, image.Rect(plot.Min.X, plot.Max.Y-1, plot.Max.X, plot.Max.Y), theme.Muted)
+	drawText(img, area.Min.X, plot.Min.Y-10, metricTitle(MetricGDP), smallFace, theme.Text)
+	drawTextCentered(img, plot.Min.X+plot.Dx()/2, plot.Max.Y+34, metricTitle(MetricPopulation), smallFace, theme.Text)
+
+	others := withAlpha(theme.Muted, 170)
+	for _, point := range valid {
+		if !point.Highlight {
+			fillCircle(img, toX(point.Population), toY(point.GDP), 3, others)
+		}
+	}
+	for _, point := range valid {
+		if point.Highlight {
+			fillCircle(img, toX(point.Population), toY(point.GDP), 4.5, theme.Accent)
+		}
+	}
+}
+
+// metricTitle names a summary metric on an axis
+func metricTitle(metric string) string {
+	if metric == MetricPopulation {
+		return "Population"
+	}
+	return "Estimated GDP"
+}
+
+// textMiddle returns the baseline that centers capital letters on y
+func textMiddle(y int, face font.Face) int {
+	return y + face.Metrics().CapHeight.Ceil()/2
+}
+
+// drawTextCentered draws label centered on x with its baseline at y
+func drawTextCentered(img *image.RGBA, x, y int, label string, face font.Face, col color.Color) {
+	drawText(img, x-MeasureText(face, label)/2, y, label, face, col)
+}
+
+// fillRect blends col over r
+func fillRect(img *image.RGBA, r image.Rectangle, col color.Color) {
+	draw.Draw(img, r, &image.Uniform{col}, image.Point{}, draw.Over)
+}
+
+// fillCircle blends a circle of col centered on (x, y), with smoothed edges
+func fillCircle(img *image.RGBA, x, y float64, radius float64, col color.Color) {
+	mask := &circleMask{x: x, y: y, radius: radius}
+	draw.DrawMask(img, mask.Bounds(), &image.Uniform{col}, image.Point{}, mask, mask.Bounds().Min, draw.Over)
+}
+
+// circleMask is the coverage of a circle, used as a drawing mask
+type circleMask struct {
+	x, y, radius float64
+}
+
+func (m *circleMask) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (m *circleMask) Bounds() image.Rectangle {
+	return image.Rect(
+		int(math.Floor(m.x-m.radius-1)), int(math.Floor(m.y-m.radius-1)),
+		int(math.Ceil(m.x+m.radius+1)), int(math.Ceil(m.y+m.radius+1)),
+	)
+}
+
+func (m *circleMask) At(x, y int) color.Color {
+	// Distance from the pixel center, with a one pixel fade at the edge
+	distance := math.Hypot(float64(x)+0.5-m.x, float64(y)+0.5-m.y)
+	coverage := math.Max(0, math.Min(1, m.radius+0.5-distance))
+	return color.Alpha{A: uint8(coverage * 255)}
+}
+
+// withAlpha returns col at opacity alpha out of 255
+func withAlpha(col color.RGBA, alpha uint8) color.RGBA {
+	scale := func(v uint8) uint8 {
+		return uint8(uint16(v) * uint16(alpha) / 255)
+	}
+	// color.RGBA is alpha-premultiplied
+	return color.RGBA{R: scale(col.R), G: scale(col.G), B: scale(col.B), A: scale(col.A)}
+}
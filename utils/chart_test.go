@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatCompact(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		want  string
+	}{
+		{name: "zero", value: 0, want: "0"},
+		{name: "below a thousand", value: 999, want: "999"},
+		{name: "small with decimal", value: 12.34, want: "12.3"},
+		{name: "rounds up to a thousand", value: 999.6, want: "1K"},
+		{name: "thousands", value: 1234, want: "1.2K"},
+		{name: "whole unit drops decimal", value: 2000, want: "2K"},
+		{name: "hundreds of a unit", value: 330000000, want: "330M"},
+		{name: "millions", value: 1234567, want: "1.2M"},
+		{name: "K rolls over to M", value: 999960, want: "1M"},
+		{name: "M rolls over to B", value: 999.96e6, want: "1B"},
+		{name: "B rolls over to T", value: 999.96e9, want: "1T"},
+		{name: "trillions", value: 2.5e12, want: "2.5T"},
+		{name: "beyond the largest unit", value: 1.5e15, want: "1500T"},
+		{name: "negative", value: -1500, want: "-1.5K"},
+		{name: "negative rollover", value: -999960, want: "-1M"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatCompact(tt.value); got != tt.want {
+				t.Errorf("FormatCompact(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct {
+		name  string
+		span  float64
+		count int
+		want  float64
+	}{
+		{name: "empty span", span: 0, count: 5, want: 1},
+		{name: "exact multiple of one", span: 50, count: 5, want: 10},
+		{name: "rounds up to two", span: 7, count: 5, want: 2},
+		{name: "rounds up to five", span: 1000, count: 4, want: 500},
+		{name: "rounds up to the next power", span: 30, count: 4, want: 10},
+		{name: "fractional span", span: 1, count: 4, want: 0.5},
+		{name: "large span", span: 3.2e9, count: 4, want: 1e9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := niceStep(tt.span, tt.count); math.Abs(got-tt.want) > 1e-9*tt.want {
+				t.Errorf("niceStep(%v, %d) = %v, want %v", tt.span, tt.count, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 
 // ComputeEstimatedGDP estimates GDP given population and exchange rate.
+// The result is in the base currency the exchange rate is quoted against.
 func ComputeEstimatedGDP(population int64, exchangeRate float64) float64 {
 	var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// ellipsis marks truncated text
+const ellipsis = "…"
+
+// FontFamily is a list of fonts tried in order for each rune, so a primary
+// font can fall back to another for scripts it doesn't cover. The embedded
+// Go fonts always come last.
+type FontFamily struct {
+	fonts []*opentype.Font
+}
+
+var (
+	goRegular = mustParseFont(goregular.TTF)
+	goBold    = mustParseFont(gobold.TTF)
+
+	// regularFonts and boldFonts are used by the image renderers;
+	// LoadFonts replaces them
+	regularFonts = &FontFamily{fonts: []*opentype.Font{goRegular}}
+	boldFonts    = &FontFamily{fonts: []*opentype.Font{goBold}}
+)
+
+func mustParseFont(data []byte) *opentype.Font {
+	f, err := opentype.Parse(data)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// parseFontFile reads a TrueType or OpenType font, or the first font of a
+// collection
+func parseFontFile(path string) (*opentype.Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font %s: %w", path, err)
+	}
+	if f, err := opentype.Parse(data); err == nil {
+		return f, nil
+	}
+	collection, err := opentype.ParseCollection(data)
+	if err != nil || collection.NumFonts() == 0 {
+		return nil, fmt.Errorf("failed to parse font %s: not a TrueType or OpenType font", path)
+	}
+	return collection.Font(0)
+}
+
+// NewFontFamily loads the font files at paths, in order of preference, with
+// fallback as the last resort
+func NewFontFamily(paths []string, fallback *opentype.Font) (*FontFamily, error) {
+	return newFontFamily(paths, fallback)
+}
+
+// newFontFamily loads the font files at paths followed by the fallback fonts
+func newFontFamily(paths []string, fallback ...*opentype.Font) (*FontFamily, error) {
+	family := &FontFamily{}
+	for _, path := range paths {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		f, err := parseFontFile(strings.TrimSpace(path))
+		if err != nil {
+			return nil, err
+		}
+		family.fonts = append(family.fonts, f)
+	}
+	family.fonts = append(family.fonts, fallback...)
+	return family, nil
+}
+
+// LoadFonts sets the regular and bold fonts used for images. Either list
+// may be empty to keep the embedded Go font.
+func LoadFonts(regularPaths []string, boldPaths []string) error {
+	regular, err := NewFontFamily(regularPaths, goRegular)
+	if err != nil {
+		return err
+	}
+	bold, err := NewFontFamily(boldPaths, goBold)
+	if err != nil {
+		return err
+	}
+	regularFonts = regular
+	boldFonts = bold
+	return nil
+}
+
+// Face returns a face of the family at size pixels. Faces are not safe for
+// concurrent use, so each rendering gets its own.
+func (f *FontFamily) Face(size float64) font.Face {
+	face := &fallbackFace{fonts: f.fonts}
+	for _, ft := range f.fonts {
+		// NewFace only fails on invalid options
+		opened, _ := opentype.NewFace(ft, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		face.faces = append(face.faces, opened)
+	}
+	return face
+}
+
+// fallbackFace draws each rune with the first font that has a glyph for it
+type fallbackFace struct {
+	fonts []*opentype.Font
+	faces []font.Face
+	buf   sfnt.Buffer
+}
+
+func (f *fallbackFace) pick(r rune) font.Face {
+	for i, ft := range f.fonts {
+		if index, err := ft.GlyphIndex(&f.buf, r); err == nil && index != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
+
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.pick(r0)
+	if face != f.pick(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
+// MeasureText returns the width of text in pixels
+func MeasureText(face font.Face, text string) int {
+	return font.MeasureString(face, text).Ceil()
+}
+
+// TruncateText shortens text to fit within maxWidth pixels, marking the cut
+// with an ellipsis
+func TruncateText(face font.Face, text string, maxWidth int) string {
+	if MeasureText(face, text) <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimRightFunc(string(runes), unicode.IsSpace) + ellipsis
+		if MeasureText(face, candidate) <= maxWidth {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// WrapText breaks text into lines no wider than maxWidth pixels, at spaces
+// where possible. Words wider than a line are split.
+func WrapText(face font.Face, text string, maxWidth int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if MeasureText(face, candidate) <= maxWidth {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// Split a word that doesn't fit on a line of its own
+		line = ""
+		for _, r := range word {
+			if line != "" && MeasureText(face, line+string(r)) > maxWidth {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
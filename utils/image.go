@@ -1,93 +1,266 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
-	"os"
-	"path/filepath"
-	"task_2/models"
+	"math"
+	"strings"
 	"time"
 
+	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/math/fixed"
 )
 
-// GenerateSummaryImage creates an image with country statistics
-func GenerateSummaryImage(totalCountries int, topCountries []models.Country, lastRefreshed time.Time, outputPath string) error {
-	// Create cache directory if it doesn't exist
-	dir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
-	}
+// Text sizes in pixels
+const (
+	titleTextSize = 22
+	bodyTextSize  = 15
+	smallTextSize = 12
+)
 
-	// Image dimensions
-	width := 800
-	height := 400
+// imageMargin is the space left and right of text
+const imageMargin = 30
+
+// Summary image sizes, in pixels
+const (
+	DefaultSummaryWidth  = 800
+	DefaultSummaryHeight = 400
+)
+
+// Summary image metrics
+const (
+	MetricGDP        = "gdp"
+	MetricPopulation = "population"
+)
+
+// logoWidth and logoHeight bound the theme logo
+const (
+	logoWidth  = 160
+	logoHeight = 40
+)
+
+// SummaryEntry is one ranked country on the summary image
+type SummaryEntry struct {
+	Name  string
+	Value float64
+}
+
+// SummaryImage is the content and size of a summary image
+type SummaryImage struct {
+	TotalCountries int
+	// Region is empty when the image covers every country
+	Region        string
+	Metric        string
+	Entries       []SummaryEntry
+	LastRefreshed time.Time
+	Width         int
+	Height        int
+	// Currency is the code GDP values are quoted in
+	Currency string
+	// Scatter adds a population vs GDP panel of Points beside the bars
+	Scatter bool
+	Points  []ScatterPoint
+}
+
+// RenderSummaryImage draws the top countries as a bar chart with theme and
+// returns the PNG encoded image. Entries that don't fit the height are left
+// out.
+func RenderSummaryImage(summary SummaryImage, theme *ImageTheme) ([]byte, error) {
+	width := summary.Width
+	height := summary.Height
 
 	// Create a new RGBA image
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
 
-	// Fill background with white
-	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	// Fill background
+	draw.Draw(img, img.Bounds(), &image.Uniform{theme.Background}, image.Point{}, draw.Src)
 
 	// Draw border
-	drawBorder(img, color.RGBA{R: 50, G: 50, B: 50, A: 255})
+	drawBorder(img, theme.Border)
 
-	// Prepare text content
-	lines := []string{
-		"Country Data Summary",
-		"",
-		fmt.Sprintf("Total Countries: %d", totalCountries),
-		"",
-		"Top 5 Countries by Estimated GDP:",
+	titleFace := theme.boldFamily().Face(titleTextSize)
+	defer titleFace.Close()
+	bodyFace := theme.regularFamily().Face(bodyTextSize)
+	defer bodyFace.Close()
+	smallFace := theme.regularFamily().Face(smallTextSize)
+	defer smallFace.Close()
+	textWidth := width - 2*imageMargin
+
+	// The title keeps clear of the logo
+	titleWidth := textWidth
+	if theme.Logo != nil {
+		titleWidth -= drawLogo(img, theme.Logo) + 10
 	}
 
-	for i, country := range topCountries {
-		if i >= 5 {
-			break
-		}
-		gdpStr := "N/A"
-		if country.EstimatedGDP != nil {
-			gdpStr = fmt.Sprintf("$%.2f", *country.EstimatedGDP)
-		}
-		lines = append(lines, fmt.Sprintf("  %d. %s - %s", i+1, country.Name, gdpStr))
+	title := "Country Data Summary"
+	if summary.Region != "" {
+		title += " - " + summary.Region
+	}
+
+	// The chart fills the space between the subtitle and the footer, with
+	// the scatter panel taking the right part when asked for
+	content := image.Rect(imageMargin, 80, width-imageMargin, height-32)
+	barArea := content
+	if summary.Scatter {
+		split := content.Min.X + content.Dx()*55/100
+		barArea.Max.X = split - 15
+		drawScatter(img, image.Rect(split+15, content.Min.Y, content.Max.X, content.Max.Y), summary.Points, summary.Currency, theme, bodyFace, smallFace)
 	}
 
-	lines = append(lines, "")
-	lines = append(lines, fmt.Sprintf("Last Refreshed: %s", lastRefreshed.Format(time.RFC3339)))
+	entries := summary.Entries
+	if fit := (barArea.Dy() - axisHeight) / minBarRowHeight; len(entries) > fit {
+		entries = entries[:max(fit, 0)]
+	}
+	drawBarChart(img, barArea, entries, summary.Metric, summary.Currency, theme, bodyFace, smallFace)
+
+	subtitle := fmt.Sprintf("Top %d of %d countries by %s", len(entries), summary.TotalCountries, metricTitle(summary.Metric))
+	footer := fmt.Sprintf("Last Refreshed: %s", summary.LastRefreshed.Format(time.RFC3339))
 
 	// Draw text
-	y := 40
-	for _, line := range lines {
-		drawText(img, 30, y, line, color.Black)
+	drawText(img, imageMargin, 40, TruncateText(titleFace, title, titleWidth), titleFace, theme.Title)
+	drawText(img, imageMargin, 62, TruncateText(bodyFace, subtitle, textWidth), bodyFace, theme.Muted)
+	drawText(img, imageMargin, height-14, TruncateText(smallFace, footer, textWidth), smallFace, theme.Muted)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLogo scales logo into the top right corner, keeping its aspect
+// ratio, and returns the width it takes
+func drawLogo(img *image.RGBA, logo image.Image) int {
+	bounds := logo.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0
+	}
+	scale := math.Min(float64(logoWidth)/float64(bounds.Dx()), float64(logoHeight)/float64(bounds.Dy()))
+	scale = math.Min(scale, 1)
+	w := int(float64(bounds.Dx()) * scale)
+	h := int(float64(bounds.Dy()) * scale)
+
+	x := img.Bounds().Max.X - imageMargin - w
+	y := 40 - (titleTextSize+h)/2
+	target := image.Rect(x, y, x+w, y+h)
+	xdraw.CatmullRom.Scale(img, target, logo, bounds, draw.Over, nil)
+	return w
+}
+
+// ComparisonEntry is one country row on the comparison card
+type ComparisonEntry struct {
+	Name         string
+	Population   int64
+	EstimatedGDP *float64
+	GDPPerCapita *float64
+	ExchangeRate *float64
+	CurrencyCode *string
+}
+
+// RenderComparisonImage draws the compared countries as a table and returns
+// the PNG encoded image. GDP values are labelled with currency, the code they
+// are quoted in. Names that were not found are listed underneath.
+func RenderComparisonImage(entries []ComparisonEntry, missing []string, currency string) ([]byte, error) {
+	titleFace := boldFonts.Face(titleTextSize)
+	defer titleFace.Close()
+	headerFace := boldFonts.Face(bodyTextSize)
+	defer headerFace.Close()
+	bodyFace := regularFonts.Face(bodyTextSize)
+	defer bodyFace.Close()
+
+	width := 800
+	textWidth := width - 2*imageMargin
+
+	// The list of missing names wraps instead of running off the image
+	var missingLines []string
+	if len(missing) > 0 {
+		missingLines = WrapText(bodyFace, "Not found: "+strings.Join(missing, ", "), textWidth)
+	}
+	height := 130 + 25*len(entries)
+	if len(missingLines) > 0 {
+		height += 5 + 20*len(missingLines)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	drawBorder(img, color.RGBA{R: 50, G: 50, B: 50, A: 255})
+
+	drawText(img, imageMargin, 40, "Country Comparison", titleFace, color.Black)
+
+	// Column x offsets: name, population, GDP, GDP per capita, exchange rate
+	columns := []int{imageMargin, 230, 360, 530, 660}
+	headerColor := color.RGBA{R: 90, G: 90, B: 90, A: 255}
+	for i, header := range []string{"Country", "Population", "Est. GDP", "GDP/Capita", "Rate"} {
+		drawText(img, columns[i], 80, header, headerFace, headerColor)
+	}
+
+	y := 105
+	for _, entry := range entries {
+		rate := formatOptional(entry.ExchangeRate, "%.2f")
+		if entry.CurrencyCode != nil && entry.ExchangeRate != nil {
+			rate = fmt.Sprintf("%s %s", rate, *entry.CurrencyCode)
+		}
+		cells := []string{
+			entry.Name,
+			fmt.Sprintf("%d", entry.Population),
+			formatOptionalGDP(entry.EstimatedGDP, currency),
+			formatOptionalGDP(entry.GDPPerCapita, currency),
+			rate,
+		}
+		for i, cell := range cells {
+			// Each cell is cut to its column, leaving a small gap
+			cellWidth := width - imageMargin - columns[i]
+			if i+1 < len(columns) {
+				cellWidth = columns[i+1] - columns[i] - 10
+			}
+			drawText(img, columns[i], y, TruncateText(bodyFace, cell, cellWidth), bodyFace, color.Black)
+		}
 		y += 25
 	}
 
-	// Save to file
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create image file: %w", err)
+	if len(missingLines) > 0 {
+		y += 5
+		for _, line := range missingLines {
+			drawText(img, imageMargin, y, line, bodyFace, color.RGBA{R: 180, G: 30, B: 30, A: 255})
+			y += 20
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
 	}
-	defer file.Close()
+	return buf.Bytes(), nil
+}
 
-	if err := png.Encode(file, img); err != nil {
-		return fmt.Errorf("failed to encode image: %w", err)
+func formatOptional(value *float64, format string) string {
+	if value == nil {
+		return "N/A"
 	}
+	return fmt.Sprintf(format, *value)
+}
 
-	return nil
+// formatOptionalGDP formats a GDP value like the chart labels do
+func formatOptionalGDP(value *float64, currency string) string {
+	if value == nil {
+		return "N/A"
+	}
+	return formatMetric(*value, MetricGDP, currency)
 }
 
-func drawText(img *image.RGBA, x, y int, label string, col color.Color) {
+// drawText draws label with its baseline at y
+func drawText(img *image.RGBA, x, y int, label string, face font.Face, col color.Color) {
 	point := fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)}
 
 	d := &font.Drawer{
 		Dst:  img,
 		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13,
+		Face: face,
 		Dot:  point,
 	}
 	d.DrawString(label)
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Match types reported by RankName, strongest first
+const (
+	MatchExact    = "exact"
+	MatchPrefix   = "prefix"
+	MatchWord     = "word_prefix"
+	MatchContains = "contains"
+	MatchFuzzy    = "fuzzy"
+)
+
+// minFuzzySimilarity is the lowest edit-distance similarity still treated as a match
+const minFuzzySimilarity = 0.6
+
+// NormalizeName folds a country name for comparison: diacritics are stripped,
+// punctuation is dropped, and whitespace is collapsed, all in lower case.
+// "Côte d'Ivoire" and "cote divoire" both normalize to "cote divoire".
+func NormalizeName(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		folded = name
+	}
+
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(folded) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_' || r == ',' || r == '/':
+			space = true
+		}
+		// Other punctuation (apostrophes, dots, brackets) is dropped outright
+	}
+	return b.String()
+}
+
+// Slugify turns a country name into a URL-safe slug, e.g.
+// "Côte d'Ivoire" becomes "cote-divoire".
+func Slugify(name string) string {
+	return strings.ReplaceAll(NormalizeName(name), " ", "-")
+}
+
+// RankName scores how well candidate matches query. Both must already be
+// normalized. The score is in (0, 1], and ok is false when there is no match.
+func RankName(query, candidate string) (score float64, matchType string, ok bool) {
+	if query == "" || candidate == "" {
+		return 0, "", false
+	}
+
+	switch {
+	case query == candidate:
+		return 1, MatchExact, true
+	case strings.HasPrefix(candidate, query):
+		return 0.9, MatchPrefix, true
+	case strings.Contains(" "+candidate, " "+query):
+		return 0.8, MatchWord, true
+	case strings.Contains(candidate, query):
+		return 0.7, MatchContains, true
+	}
+
+	similarity := 1 - float64(Levenshtein(query, candidate))/float64(max(runeLen(query), runeLen(candidate)))
+	if similarity < minFuzzySimilarity {
+		return 0, "", false
+	}
+	// Keep fuzzy matches below every substring match
+	return 0.6 * similarity, MatchFuzzy, true
+}
+
+// Levenshtein returns the edit distance between a and b, counted in runes.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func runeLen(s string) int {
+	return len([]rune(s))
+}
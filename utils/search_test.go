@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "accents and apostrophe", input: "Côte d'Ivoire", want: "cote divoire"},
+		{name: "already normalized", input: "cote divoire", want: "cote divoire"},
+		{name: "ring above", input: "Åland Islands", want: "aland islands"},
+		{name: "hyphen and underscore", input: "Bosnia-and_Herzegovina", want: "bosnia and herzegovina"},
+		{name: "dots and commas", input: "St. Kitts, Nevis", want: "st kitts nevis"},
+		{name: "dropped symbol between words", input: "São Tomé & Príncipe", want: "sao tome principe"},
+		{name: "brackets", input: "Türkiye (Turkey)", want: "turkiye turkey"},
+		{name: "surrounding and repeated spaces", input: "  United   Kingdom ", want: "united kingdom"},
+		{name: "digits kept", input: "Area 51", want: "area 51"},
+		{name: "empty", input: "", want: ""},
+		{name: "punctuation only", input: "'.()", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeName(tt.input); got != tt.want {
+				t.Errorf("NormalizeName(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "accents and apostrophe", input: "Côte d'Ivoire", want: "cote-divoire"},
+		{name: "spaces", input: "Bosnia and Herzegovina", want: "bosnia-and-herzegovina"},
+		{name: "hyphen kept once", input: "Guinea - Bissau", want: "guinea-bissau"},
+		{name: "punctuation", input: "St. Vincent & the Grenadines", want: "st-vincent-the-grenadines"},
+		{name: "single word", input: "Nigeria", want: "nigeria"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Slugify(tt.input); got != tt.want {
+				t.Errorf("Slugify(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankName(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		candidate string
+		wantScore float64
+		wantType  string
+		wantOK    bool
+	}{
+		{name: "exact", query: "nigeria", candidate: "nigeria", wantScore: 1, wantType: MatchExact, wantOK: true},
+		{name: "prefix", query: "united", candidate: "united states", wantScore: 0.9, wantType: MatchPrefix, wantOK: true},
+		{name: "word prefix", query: "sta", candidate: "united states", wantScore: 0.8, wantType: MatchWord, wantOK: true},
+		{name: "contains", query: "ted", candidate: "united states", wantScore: 0.7, wantType: MatchContains, wantOK: true},
+		{name: "fuzzy typo", query: "germny", candidate: "germany", wantScore: 0.6 * 6 / 7, wantType: MatchFuzzy, wantOK: true},
+		{name: "fuzzy at threshold", query: "abcde", candidate: "abcxy", wantScore: 0.6 * 0.6, wantType: MatchFuzzy, wantOK: true},
+		{name: "below fuzzy threshold", query: "abcde", candidate: "abxyz"},
+		{name: "empty query", query: "", candidate: "nigeria"},
+		{name: "empty candidate", query: "nigeria", candidate: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, matchType, ok := RankName(tt.query, tt.candidate)
+			if ok != tt.wantOK || matchType != tt.wantType || math.Abs(score-tt.wantScore) > 1e-9 {
+				t.Errorf("RankName(%q, %q) = %v, %q, %v, want %v, %q, %v",
+					tt.query, tt.candidate, score, matchType, ok, tt.wantScore, tt.wantType, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want int
+	}{
+		{name: "equal", a: "chad", b: "chad", want: 0},
+		{name: "both empty", a: "", b: "", want: 0},
+		{name: "one empty", a: "", b: "peru", want: 4},
+		{name: "substitution", a: "iran", b: "iraq", want: 1},
+		{name: "insertion", a: "germny", b: "germany", want: 1},
+		{name: "classic", a: "kitten", b: "sitting", want: 3},
+		{name: "counted in runes", a: "côte", b: "cote", want: 1},
+		{name: "symmetric", a: "sitting", b: "kitten", want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Levenshtein(tt.a, tt.b); got != tt.want {
+				t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultTheme is used when a summary image asks for no theme
+const DefaultTheme = "light"
+
+// defaultThemesJSON defines the built-in light, dark and brand themes
+//
+//go:embed themes.json
+var defaultThemesJSON []byte
+
+// ImageTheme holds the colors, fonts and logo an image is drawn with
+type ImageTheme struct {
+	Background color.RGBA
+	Border     color.RGBA
+	Title      color.RGBA
+	Text       color.RGBA
+	Muted      color.RGBA
+	Accent     color.RGBA
+	Error      color.RGBA
+	// Regular and Bold are nil to use the fonts set by LoadFonts
+	Regular *FontFamily
+	Bold    *FontFamily
+	// Logo is drawn in the top right corner when set
+	Logo image.Image
+	// Fingerprint changes with the theme definition, so images cached
+	// under an older definition are not served
+	Fingerprint string
+}
+
+// themeDefinition is one theme as written in a themes file. Colors are
+// #rrggbb or #rrggbbaa.
+type themeDefinition struct {
+	Background string   `json:"background"`
+	Border     string   `json:"border"`
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	Muted      string   `json:"muted"`
+	Accent     string   `json:"accent"`
+	Error      string   `json:"error"`
+	Fonts      []string `json:"fonts"`
+	BoldFonts  []string `json:"bold_fonts"`
+	Logo       string   `json:"logo"`
+}
+
+var themes = mustParseDefaultThemes()
+
+func mustParseDefaultThemes() map[string]*ImageTheme {
+	definitions, err := parseThemeDefinitions(defaultThemesJSON)
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*ImageTheme, len(definitions))
+	for name, definition := range definitions {
+		theme, err := newImageTheme(definition, definitions[DefaultTheme], "")
+		if err != nil {
+			panic(err)
+		}
+		loaded[name] = theme
+	}
+	return loaded
+}
+
+func parseThemeDefinitions(data []byte) (map[string]themeDefinition, error) {
+	var raw map[string]themeDefinition
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	definitions := make(map[string]themeDefinition, len(raw))
+	for name, definition := range raw {
+		definitions[strings.ToLower(strings.TrimSpace(name))] = definition
+	}
+	return definitions, nil
+}
+
+// LoadThemes adds the themes defined in the JSON file at path to the
+// built-in ones, replacing those with the same name. Relative font and logo
+// paths are resolved against the file's directory. An empty path keeps the
+// built-in themes. Call it after LoadFonts, as theme fonts fall back to
+// those.
+func LoadThemes(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read themes file: %w", err)
+	}
+	definitions, err := parseThemeDefinitions(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse themes file %s: %w", path, err)
+	}
+
+	base, err := parseThemeDefinitions(defaultThemesJSON)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]*ImageTheme, len(themes)+len(definitions))
+	for name, theme := range themes {
+		loaded[name] = theme
+	}
+	for name, definition := range definitions {
+		if name == "" {
+			return fmt.Errorf("themes file %s has a theme without a name", path)
+		}
+		// Missing colors come from the built-in theme of the same name,
+		// or the light theme for new ones
+		fallback, ok := base[name]
+		if !ok {
+			fallback = base[DefaultTheme]
+		}
+		theme, err := newImageTheme(definition, fallback, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("theme %s: %w", name, err)
+		}
+		loaded[name] = theme
+	}
+	themes = loaded
+	return nil
+}
+
+// newImageTheme builds a theme from its definition, taking missing colors
+// from base and resolving relative paths against dir
+func newImageTheme(definition themeDefinition, base themeDefinition, dir string) (*ImageTheme, error) {
+	theme := &ImageTheme{}
+	colors := []struct {
+		target   *color.RGBA
+		value    string
+		fallback string
+		field    string
+	}{
+		{&theme.Background, definition.Background, base.Background, "background"},
+		{&theme.Border, definition.Border, base.Border, "border"},
+		{&theme.Title, definition.Title, base.Title, "title"},
+		{&theme.Text, definition.Text, base.Text, "text"},
+		{&theme.Muted, definition.Muted, base.Muted, "muted"},
+		{&theme.Accent, definition.Accent, base.Accent, "accent"},
+		{&theme.Error, definition.Error, base.Error, "error"},
+	}
+	for _, c := range colors {
+		value := c.value
+		if value == "" {
+			value = c.fallback
+		}
+		parsed, err := parseHexColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.field, err)
+		}
+		*c.target = parsed
+	}
+
+	resolve := func(path string) string {
+		if dir == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	fingerprint := sha256.New()
+	if err := json.NewEncoder(fingerprint).Encode(definition); err != nil {
+		return nil, err
+	}
+
+	if len(definition.Fonts) > 0 {
+		paths := make([]string, 0, len(definition.Fonts))
+		for _, path := range definition.Fonts {
+			paths = append(paths, resolve(path))
+		}
+		family, err := newFontFamily(paths, regularFonts.fonts...)
+		if err != nil {
+			return nil, err
+		}
+		theme.Regular = family
+	}
+	if len(definition.BoldFonts) > 0 {
+		paths := make([]string, 0, len(definition.BoldFonts))
+		for _, path := range definition.BoldFonts {
+			paths = append(paths, resolve(path))
+		}
+		family, err := newFontFamily(paths, boldFonts.fonts...)
+		if err != nil {
+			return nil, err
+		}
+		theme.Bold = family
+	}
+
+	if definition.Logo != "" {
+		data, err := os.ReadFile(resolve(definition.Logo))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read logo: %w", err)
+		}
+		logo, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode logo %s: %w", definition.Logo, err)
+		}
+		theme.Logo = logo
+		// A replaced logo file changes the images too
+		fingerprint.Write(data)
+	}
+
+	theme.Fingerprint = hex.EncodeToString(fingerprint.Sum(nil))[:16]
+	return theme, nil
+}
+
+// parseHexColor parses #rrggbb or #rrggbbaa
+func parseHexColor(value string) (color.RGBA, error) {
+	hexValue := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(hexValue) == 6 {
+		hexValue += "ff"
+	}
+	decoded, err := hex.DecodeString(hexValue)
+	if err != nil || len(decoded) != 4 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb or #rrggbbaa", value)
+	}
+	return color.RGBA{R: decoded[0], G: decoded[1], B: decoded[2], A: decoded[3]}, nil
+}
+
+// GetTheme returns the named theme
+func GetTheme(name string) (*ImageTheme, bool) {
+	theme, ok := themes[strings.ToLower(name)]
+	return theme, ok
+}
+
+// ThemeNames lists the available themes alphabetically
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *ImageTheme) regularFamily() *FontFamily {
+	if t.Regular != nil {
+		return t.Regular
+	}
+	return regularFonts
+}
+
+func (t *ImageTheme) boldFamily() *FontFamily {
+	if t.Bold != nil {
+		return t.Bold
+	}
+	return boldFonts
+}